@@ -12,9 +12,18 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cxntered/SpareChange/internal/assets"
+	"github.com/cxntered/SpareChange/pkg/analysis"
+	"github.com/cxntered/SpareChange/pkg/audio"
+	"github.com/cxntered/SpareChange/pkg/clicktrack"
 	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/preview"
+	"github.com/cxntered/SpareChange/pkg/skin"
+	"github.com/cxntered/SpareChange/pkg/stats"
+	"github.com/cxntered/SpareChange/pkg/termview"
 	"github.com/cxntered/SpareChange/pkg/types"
 	"github.com/cxntered/SpareChange/pkg/utils"
 	"github.com/disintegration/imaging"
@@ -22,20 +31,56 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		convert(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		renderPreview(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "view" {
+		viewChart(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		printInfo(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "skin" {
+		generateSkin(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "synccheck" {
+		syncCheck(os.Args[2:])
+		return
+	}
+
 	beta := flag.BoolP("beta", "b", false, "Whether to fetch a beta Sparebeat map")
 	path := flag.StringP("path", "p", "", "Path to a local Sparebeat map JSON file")
-	music := flag.StringP("music", "m", "", "Path to a local .mp3 audio file to use")
+	music := flag.StringP("music", "m", "", "Path to a local audio file to use (.mp3 or .ogg, others are bundled with a warning)")
+	cover := flag.Bool("cover", false, "Use the cover art embedded in --music as the background")
+	embedSource := flag.Bool("embed-source", false, "Embed the original Sparebeat map into the .osz so it can be restored later")
+	conversion := addConversionFlags(flag.CommandLine)
+	trimSilence := flag.Bool("trim-silence", false, "Cut silence from the start of the audio, moving the chart along with it")
 	flag.Parse()
 
 	args := flag.Args()
 	if *path == "" && len(args) == 0 {
 		fmt.Println("Usage: sparechange [options] <id>")
+		fmt.Println("       sparechange convert [options] <input> <output>")
+		fmt.Println("       sparechange preview [options] <input> <output.png>")
+		fmt.Println("       sparechange view [options] <input>")
+		fmt.Println("       sparechange info [options] <input>")
+		fmt.Println("       sparechange skin [options] [output]")
+		fmt.Println("       sparechange synccheck [options] <input> <audio.mp3> <output.wav>")
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	var sbMap types.SparebeatMap
+	var body []byte
 
 	if *path != "" {
 		file, err := os.Open(*path)
@@ -44,7 +89,7 @@ func main() {
 			os.Exit(1)
 		}
 		defer file.Close()
-		body, err := io.ReadAll(file)
+		body, err = io.ReadAll(file)
 		if err != nil {
 			fmt.Printf("Error reading map file: %v\n", err)
 			os.Exit(1)
@@ -68,7 +113,7 @@ func main() {
 			os.Exit(1)
 		}
 		defer res.Body.Close()
-		body, err := io.ReadAll(res.Body)
+		body, err = io.ReadAll(res.Body)
 		if err != nil {
 			fmt.Printf("Error reading response body: %v\n", err)
 			os.Exit(1)
@@ -79,72 +124,623 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Printf("Fetched & parsed map: %+v\n", sbMap.Title)
+		if sbMap.ID == "" {
+			sbMap.ID = id
+		}
 	}
 
 	// convert map to osu! format
-	osuMap, err := converter.ConvertSparebeatToOsu(sbMap)
+	opts := conversion.options(*beta, sbMap.ID)
+	result, err := converter.ConvertSparebeatToOsuWithOptions(sbMap, opts)
+	printWarnings(result.Warnings)
 	if err != nil {
 		fmt.Printf("Error converting Sparebeat map to osu! format: %v\n", err)
 		os.Exit(1)
 	}
+	osuMap := result.Map
+	osuMap.Source = body
 	fmt.Println("Converted map to osu! format")
 
-	// create temp dir for conversion
-	tempDir := os.TempDir()
-	sparebeatDir := filepath.Join(tempDir, "sparechange")
-	err = os.MkdirAll(sparebeatDir, os.ModePerm)
+	id := ""
+	if *path == "" && len(args) > 0 {
+		id = args[0]
+	}
+	shift := bundleFiles(&osuMap, sbMap, id, *music, *beta, *cover, *trimSilence)
+	// only once the audio is lined up, which can make room for early notes itself
+	printWarnings(converter.ApplyLeadIn(&osuMap))
+
+	if *embedSource {
+		if id == "" {
+			id = sbMap.ID
+		}
+		err = converter.EmbedSource(&osuMap, id, conversion.manifest(opts, *beta, shift))
+		if err != nil {
+			fmt.Printf("Error embedding Sparebeat source: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Embedded original Sparebeat map")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current working directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	osz, err := converter.LookupFormat("osz")
+	if err != nil {
+		fmt.Printf("Error looking up .osz format: %v\n", err)
+		os.Exit(1)
+	}
+	err = writeOutput(osuMap, osz, filepath.Join(cwd, converter.OszFileName(osuMap)))
+	if err != nil {
+		fmt.Printf("Error writing .osz file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created .osz file: %s - %s.osz\n", osuMap.Metadata.Artist, osuMap.Metadata.Title)
+}
+
+func convert(arguments []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := flags.String("from", "", "Input format, detected from the input file extension if omitted")
+	to := flags.String("to", "", "Output format, detected from the output file extension if omitted")
+	level := flags.StringP("level", "l", "", "Only convert this level (easy, normal or hard)")
+	beta := flags.BoolP("beta", "b", false, "Whether to fetch audio for a beta Sparebeat map")
+	music := flags.StringP("music", "m", "", "Path to a local audio file to bundle into an .osz (.mp3 or .ogg, others are bundled with a warning)")
+	cover := flags.Bool("cover", false, "Use the cover art embedded in --music as the background")
+	sourceMap := flags.String("source-map", "", "Path to write a JSON map of where each osu! object came from in the Sparebeat map")
+	embedSource := flags.Bool("embed-source", false, "Embed the original Sparebeat map into an .osz so it can be restored later")
+	conversion := addConversionFlags(flags)
+	trimSilence := flags.Bool("trim-silence", false, "Cut silence from the start of the audio, moving the chart along with it")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) != 2 {
+		fmt.Println("Usage: sparechange convert [options] <input> <output>")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		fmt.Println("Formats:")
+		for _, f := range converter.Formats() {
+			var modes []string
+			if f.CanRead() {
+				modes = append(modes, "read")
+			}
+			if f.CanWrite() {
+				modes = append(modes, "write")
+			}
+			fmt.Printf("  %-10s %-15s %s\n", f.Name, strings.Join(f.Extensions, ", "), strings.Join(modes, "/"))
+		}
+		os.Exit(1)
+	}
+	input, output := args[0], args[1]
+
+	inFormat, err := converter.ResolveFormat(*from, input)
+	if err != nil {
+		fmt.Printf("Error resolving input format: %v\n", err)
+		os.Exit(1)
+	}
+	outFormat, err := converter.ResolveFormat(*to, output)
+	if err != nil {
+		fmt.Printf("Error resolving output format: %v\n", err)
+		os.Exit(1)
+	}
+	if !inFormat.CanRead() {
+		fmt.Printf("Error: format %q cannot be used as input\n", inFormat.Name)
+		os.Exit(1)
+	}
+	if !outFormat.CanWrite() {
+		fmt.Printf("Error: format %q cannot be used as output\n", outFormat.Name)
+		os.Exit(1)
+	}
+
+	body, err := os.ReadFile(input)
 	if err != nil {
-		fmt.Printf("Error creating temp directory: %v\n", err)
+		fmt.Printf("Error reading input file: %v\n", err)
 		os.Exit(1)
 	}
 
-	// write osu! files for each difficulty
-	var diffFiles []string
-	for _, diffMap := range osuMap.Difficulties {
-		fileName := fmt.Sprintf("%s - %s (%s) [%s].osu",
-			diffMap.Metadata.Artist,
-			diffMap.Metadata.Title,
-			diffMap.Metadata.Creator,
-			diffMap.Metadata.Version,
-		)
-		file := filepath.Join(sparebeatDir, utils.Sanitize(fileName))
-		diffFiles = append(diffFiles, file)
-		err = converter.WriteOsuFile(diffMap, file)
+	// the registry is keyed by Sparebeat map ID, which only Sparebeat maps have
+	var sbMap types.SparebeatMap
+	if inFormat.Name == "sparebeat" {
+		err = json.Unmarshal(body, &sbMap)
 		if err != nil {
-			fmt.Printf("Error writing osu! file: %v\n", err)
+			fmt.Printf("Error parsing map JSON: %v\n", err)
 			os.Exit(1)
 		}
 	}
-	fmt.Println("Wrote map difficulties' .osu files")
 
-	// handle music
-	var audioFile string = filepath.Join(sparebeatDir, "audio.mp3")
-	if *music != "" {
-		in, err := os.Open(*music)
+	opts := conversion.options(*beta, sbMap.ID)
+	result, err := inFormat.Read(bytes.NewReader(body), opts)
+	printWarnings(result.Warnings)
+	if err != nil {
+		fmt.Printf("Error reading %s map: %v\n", inFormat.Name, err)
+		os.Exit(1)
+	}
+	osuMap := result.Map
+	fmt.Printf("Read %s map: %s\n", inFormat.Name, osuMap.Metadata.Title)
+
+	if *level != "" {
+		var diffs []types.OsuFile
+		for _, diff := range osuMap.Difficulties {
+			if strings.EqualFold(diff.Metadata.Version, *level) {
+				diffs = append(diffs, diff)
+			}
+		}
+		if len(diffs) == 0 {
+			fmt.Printf("Error: map has no %q level\n", *level)
+			os.Exit(1)
+		}
+		osuMap.Difficulties = diffs
+	}
+
+	// only Sparebeat maps carry what's needed to bundle audio & a background
+	shift := 0
+	if outFormat.Name == "osz" && inFormat.Name == "sparebeat" {
+		shift = bundleFiles(&osuMap, sbMap, sbMap.ID, *music, *beta, *cover, *trimSilence)
+	}
+	// only once the audio is lined up, which can make room for early notes itself
+	if inFormat.Name == "sparebeat" {
+		printWarnings(converter.ApplyLeadIn(&osuMap))
+	}
+
+	if *embedSource && outFormat.Name == "osz" {
+		// a map without a source is left for EmbedSource to report
+		var source types.SparebeatMap
+		if len(osuMap.Source) > 0 {
+			err = json.Unmarshal(osuMap.Source, &source)
+			if err != nil {
+				fmt.Printf("Error parsing Sparebeat source: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		manifest := conversion.manifest(opts, *beta, shift)
+		manifest["level"] = *level
+		err = converter.EmbedSource(&osuMap, source.ID, manifest)
 		if err != nil {
-			fmt.Printf("Error opening music file: %v\n", err)
+			fmt.Printf("Error embedding Sparebeat source: %v\n", err)
 			os.Exit(1)
 		}
-		defer in.Close()
-		out, err := os.Create(audioFile)
+		fmt.Println("Embedded original Sparebeat map")
+	}
+
+	err = writeOutput(osuMap, outFormat, output)
+	if err != nil {
+		fmt.Printf("Error writing %s file: %v\n", outFormat.Name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s file: %s\n", outFormat.Name, output)
+
+	if *sourceMap != "" {
+		f, err := os.Create(*sourceMap)
 		if err != nil {
-			fmt.Printf("Error creating audio file: %v\n", err)
+			fmt.Printf("Error creating source map file: %v\n", err)
 			os.Exit(1)
 		}
-		_, err = io.Copy(out, in)
+		defer f.Close()
+		err = converter.WriteSourceMap(osuMap, f)
 		if err != nil {
-			fmt.Printf("Error copying audio file: %v\n", err)
+			fmt.Printf("Error writing source map: %v\n", err)
 			os.Exit(1)
 		}
-		out.Close()
-		fmt.Println("Copied local music audio file")
+		fmt.Printf("Wrote source map: %s\n", *sourceMap)
+	}
+}
+
+func renderPreview(arguments []string) {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	from := flags.String("from", "", "Input format, detected from the input file extension if omitted")
+	level := flags.StringP("level", "l", "", "Level to draw (easy, normal or hard), defaults to the first one")
+	scale := flags.Float64("scale", 0.25, "Pixels per millisecond")
+	height := flags.Int("height", 1200, "Height of each strip in pixels")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) != 2 {
+		fmt.Println("Usage: sparechange preview [options] <input> <output.png>")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	input, output := args[0], args[1]
+
+	inFormat, body, diff := readLevel(input, *from, *level)
+
+	opts := preview.Options{Scale: *scale, StripHeight: *height}
+	var img image.Image
+	var err error
+	if inFormat.Name == "sparebeat" {
+		// draw bind zones from the Sparebeat map itself
+		var sbMap types.SparebeatMap
+		err = json.Unmarshal(body, &sbMap)
+		if err != nil {
+			fmt.Printf("Error parsing map JSON: %v\n", err)
+			os.Exit(1)
+		}
+		img, err = preview.RenderSparebeatLevel(sbMap, diff.Metadata.Version, opts)
+		if err != nil {
+			fmt.Printf("Error rendering preview: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		img = preview.RenderOsuFile(diff, opts)
+	}
+
+	err = imaging.Save(img, output)
+	if err != nil {
+		fmt.Printf("Error writing preview image: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s preview: %s\n", diff.Metadata.Version, output)
+}
+
+func printInfo(arguments []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	from := flags.String("from", "", "Input format, detected from the input file extension if omitted")
+	asJSON := flags.Bool("json", false, "Print the stats as JSON instead of a table")
+	measures := flags.Bool("measures", false, "Also print the pattern of every measure")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) != 1 {
+		fmt.Println("Usage: sparechange info [options] <input>")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	inFormat, err := converter.ResolveFormat(*from, args[0])
+	if err != nil {
+		fmt.Printf("Error resolving input format: %v\n", err)
+		os.Exit(1)
+	}
+	if !inFormat.CanRead() {
+		fmt.Printf("Error: format %q cannot be used as input\n", inFormat.Name)
+		os.Exit(1)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error opening input file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	result, err := inFormat.Read(f, converter.Options{})
+	if err != nil {
+		fmt.Printf("Error reading %s map: %v\n", inFormat.Name, err)
+		os.Exit(1)
+	}
+
+	// bind zones are only known exactly when reading a Sparebeat map
+	levels := stats.FromOsuMap(result.Map)
+	if inFormat.Name == "sparebeat" {
+		levels = stats.FromResult(result)
+	}
+
+	if *asJSON {
+		// measures are nested in the stats so the output stays a single JSON document
+		var output interface{} = levels
+		if *measures {
+			output = struct {
+				Levels   []stats.LevelStats `json:"levels"`
+				Analysis []analysis.Report  `json:"analysis"`
+			}{levels, analysis.FromOsuMap(result.Map)}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(output)
+	} else {
+		fmt.Printf("%s - %s\n\n", result.Map.Metadata.Artist, result.Map.Metadata.Title)
+		err = stats.WriteTable(levels, os.Stdout)
+	}
+	if err != nil {
+		fmt.Printf("Error writing stats: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *measures && !*asJSON {
+		for _, report := range analysis.FromOsuMap(result.Map) {
+			fmt.Printf("\n[%s]\n", report.Level)
+			for _, measure := range report.Measures {
+				fmt.Printf("%4d  %9s  %3d notes  %s\n", measure.Index, termview.FormatTime(float64(measure.Start)), measure.Notes, measure.Pattern)
+			}
+		}
+	}
+}
+
+// readLevel reads a map in any readable format & picks one of its levels, the first one by default
+func readLevel(input string, from string, level string) (converter.Format, []byte, types.OsuFile) {
+	inFormat, err := converter.ResolveFormat(from, input)
+	if err != nil {
+		fmt.Printf("Error resolving input format: %v\n", err)
+		os.Exit(1)
+	}
+	if !inFormat.CanRead() {
+		fmt.Printf("Error: format %q cannot be used as input\n", inFormat.Name)
+		os.Exit(1)
+	}
+
+	body, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Printf("Error reading input file: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := inFormat.Read(bytes.NewReader(body), converter.Options{})
+	if err != nil {
+		fmt.Printf("Error reading %s map: %v\n", inFormat.Name, err)
+		os.Exit(1)
+	}
+	if len(result.Map.Difficulties) == 0 {
+		fmt.Println("Error: map has no levels")
+		os.Exit(1)
+	}
+
+	diff := result.Map.Difficulties[0]
+	if level != "" {
+		found := false
+		for _, d := range result.Map.Difficulties {
+			if strings.EqualFold(d.Metadata.Version, level) {
+				diff, found = d, true
+			}
+		}
+		if !found {
+			fmt.Printf("Error: map has no %q level\n", level)
+			os.Exit(1)
+		}
+	}
+
+	return inFormat, body, diff
+}
+
+func syncCheck(arguments []string) {
+	flags := flag.NewFlagSet("synccheck", flag.ExitOnError)
+	from := flags.String("from", "", "Input format, detected from the input file extension if omitted")
+	level := flags.StringP("level", "l", "", "Level to click along to (easy, normal or hard), defaults to the first one")
+	beats := flags.Bool("beats", false, "Click on every beat of the timing points instead of every note, accenting the first beat of each measure")
+	offset := flags.Int("offset", 0, "Milliseconds to move the chart by, positive is later")
+	trimSilence := flags.Bool("trim-silence", false, "Cut silence from the start of the audio, moving the chart along with it")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) != 3 {
+		fmt.Println("Usage: sparechange synccheck [options] <input> <audio.mp3> <output.wav>")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	input, music, output := args[0], args[1], args[2]
+
+	inFormat, _, diff := readLevel(input, *from, *level)
+	osuMap := types.OsuMap{Difficulties: []types.OsuFile{diff}}
+	converter.Shift(&osuMap, *offset)
+
+	data, err := os.ReadFile(music)
+	if err != nil {
+		fmt.Printf("Error reading music file: %v\n", err)
+		os.Exit(1)
+	}
+	info := checkAudio(osuMap, data)
+	if info.Format != audio.FormatMP3 {
+		fmt.Println("Error: only MP3 audio can be decoded for a sync check")
+		os.Exit(1)
+	}
+
+	// line the chart up the same way converting it would, so the clicks are where they'll be in osu!
+	end := info.Duration
+	if inFormat.Name == "sparebeat" {
+		var shift int
+		data, shift = alignAudio(&osuMap, data, *trimSilence)
+		end += shift
+		printWarnings(converter.ApplyLeadIn(&osuMap))
+	}
+	diff = osuMap.Difficulties[0]
+
+	clicks := clicktrack.NoteClicks(diff)
+	if *beats {
+		clicks = clicktrack.BeatClicks(diff, end)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("Error creating output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	err = clicktrack.Render(f, data, clicks)
+	if err != nil {
+		fmt.Printf("Error rendering sync check: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s sync check with %d clicks: %s\n", diff.Metadata.Version, len(clicks), output)
+}
+
+func generateSkin(arguments []string) {
+	flags := flag.NewFlagSet("skin", flag.ExitOnError)
+	attackNotes := flags.Bool("attack-notes", false, "Draw every note in the attack-note style")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) > 1 {
+		fmt.Println("Usage: sparechange skin [options] [output]")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	output := skin.Name + ".osk"
+	if len(args) == 1 {
+		output = args[0]
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("Error creating skin file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	err = skin.WriteOsk(skin.Options{AttackNotes: *attackNotes}, f)
+	if err != nil {
+		fmt.Printf("Error writing skin: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created skin: %s\n", output)
+}
+
+// conversionFlags are the flags shared by every command that converts Sparebeat maps
+type conversionFlags struct {
+	bindZones      *string
+	storyboard     *bool
+	registry       *string
+	preview        *string
+	breakThreshold *int
+	offset         *int
+	scroll         *string
+}
+
+func addConversionFlags(flags *flag.FlagSet) conversionFlags {
+	return conversionFlags{
+		bindZones:      flags.String("bind-zones", "", "How to show bind zones: kiai, storyboard, bookmarks or none (default kiai, or storyboard with --storyboard)"),
+		storyboard:     flags.Bool("storyboard", false, "Generate a storyboard with Sparebeat's background gradient & a title card"),
+		registry:       flags.String("registry", "", "Path to a JSON file of osu! beatmap IDs to reuse for already submitted maps"),
+		preview:        flags.String("preview", "densest", "Where song select previews the song: densest, bind-zone, none or a time in milliseconds"),
+		breakThreshold: flags.Int("break-threshold", 5000, "Milliseconds without notes that become a break period, 0 for no breaks"),
+		offset:         flags.Int("offset", 0, "Milliseconds to move the chart by, positive is later"),
+		scroll:         flags.String("scroll", "faithful", "How to reproduce Sparebeat's scroll speed: faithful, constant (no SV) or osu-native"),
+	}
+}
+
+// options turns the flags into conversion options, looking the map's IDs up in the registry
+func (f conversionFlags) options(beta bool, mapID string) converter.Options {
+	opts := converter.Options{Storyboard: *f.storyboard, Beta: beta, BreakThreshold: *f.breakThreshold, Offset: *f.offset}
+	if *f.breakThreshold <= 0 {
+		opts.BreakThreshold = -1 // the converter's zero value means the default
+	}
+	if *f.bindZones != "" {
+		mode, err := converter.ParseBindZoneMode(*f.bindZones)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.BindZones = mode
+	}
+	if *f.scroll != "" {
+		mode, err := converter.ParseScrollMode(*f.scroll)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Scroll = mode
+	}
+
+	// the preview point is either a mode or a time
+	if ms, err := strconv.Atoi(*f.preview); err == nil {
+		opts.Preview = converter.PreviewTime
+		opts.PreviewTime = ms
 	} else {
-		id := ""
-		if *path == "" && len(args) > 0 {
-			id = args[0]
+		mode, err := converter.ParsePreviewMode(*f.preview)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Preview = mode
+	}
+
+	if *f.registry != "" {
+		file, err := os.Open(*f.registry)
+		if err != nil {
+			fmt.Printf("Error opening registry file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		ids, err := converter.ReadRegistry(file)
+		if err != nil {
+			fmt.Printf("Error parsing registry file: %v\n", err)
+			os.Exit(1)
+		}
+		if found, ok := ids.Lookup(mapID, beta); ok {
+			opts.IDs = found
+			fmt.Printf("Using beatmap set ID %d from registry\n", found.SetID)
+		}
+	}
+	return opts
+}
+
+// manifest records the options & how far the audio moved the chart in an embedded source's manifest
+func (f conversionFlags) manifest(opts converter.Options, beta bool, shift int) map[string]string {
+	return map[string]string{
+		"beta":       strconv.FormatBool(beta),
+		"bindZones":  string(opts.BindZones),
+		"storyboard": strconv.FormatBool(opts.Storyboard),
+		"preview":    *f.preview,
+		"breaks":     strconv.Itoa(*f.breakThreshold),
+		"offset":     strconv.Itoa(*f.offset),
+		"scroll":     string(opts.Scroll),
+		"shift":      strconv.Itoa(shift),
+	}
+}
+
+func printWarnings(warnings []converter.Warning) {
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
+
+func writeOutput(osuMap types.OsuMap, format converter.Format, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = format.Write(osuMap, f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// bundleFiles adds the audio & background image that go into the .osz alongside the difficulties,
+// returning how far lining up the audio moved the chart
+func bundleFiles(osuMap *types.OsuMap, sbMap types.SparebeatMap, id string, music string, beta bool, cover bool, trimSilence bool) int {
+	if osuMap.Files == nil {
+		osuMap.Files = make(map[string][]byte)
+	}
+	files := osuMap.Files
+	var coverArt []byte
+
+	// handle music
+	var data []byte
+	var format audio.Format
+	if music != "" {
+		var err error
+		data, err = os.ReadFile(music)
+		if err != nil {
+			fmt.Printf("Error reading music file: %v\n", err)
+			os.Exit(1)
+		}
+		format = checkAudio(*osuMap, data).Format
+		fmt.Println("Copied local music audio file")
+
+		// local files tend to be tagged better than Sparebeat's metadata
+		if tags, ok := audio.ReadID3v2(data); ok {
+			converter.ApplyAudioTags(osuMap, tags)
+			fmt.Println("Read metadata from the music file's ID3 tags")
+			if cover {
+				coverArt = tags.Cover
+			}
+		}
+		if cover && coverArt == nil {
+			fmt.Println("Music file has no cover art, using the default background")
+		}
+	} else if id != "" {
+		if cover {
+			fmt.Println("Cover art is only read from a local music file, using the default background")
 		}
 		var audioURL string = fmt.Sprintf("https://sparebeat.com/play/%s/music", id)
-		if *beta {
+		if beta {
 			audioURL = fmt.Sprintf("https://beta.sparebeat.com/api/tracks/%s/audio", id)
 		}
 		resp, err := http.Get(audioURL)
@@ -153,31 +749,91 @@ func main() {
 			os.Exit(1)
 		}
 		defer resp.Body.Close()
-		out, err := os.Create(audioFile)
-		if err != nil {
-			fmt.Printf("Error creating audio file: %v\n", err)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Error downloading audio file: %s\n", resp.Status)
 			os.Exit(1)
 		}
-		_, err = io.Copy(out, resp.Body)
+		data, err = io.ReadAll(resp.Body)
 		if err != nil {
 			fmt.Printf("Error saving audio file: %v\n", err)
 			os.Exit(1)
 		}
-		out.Close()
+		format = checkAudio(*osuMap, data).Format
 		fmt.Println("Downloaded music audio file")
+	} else {
+		fmt.Println("No map ID or local music file given, skipping audio")
+	}
+
+	shift := 0
+	if data != nil {
+		var aligned []byte
+		aligned, shift = alignAudio(osuMap, data, trimSilence)
+		// keep the extension osu! needs to recognize the format
+		files[converter.SetAudioFilename(osuMap, format)] = aligned
 	}
 
 	// create background image
-	img, _, err := image.Decode(bytes.NewReader(assets.Background))
+	background, err := createBackground(sbMap, coverArt)
 	if err != nil {
-		fmt.Printf("Error decoding background image: %v\n", err)
+		fmt.Printf("Error creating background image: %v\n", err)
 		os.Exit(1)
 	}
+	files["background.png"] = background
+	fmt.Println("Created background image")
+	return shift
+}
+
+// checkAudio makes sure the audio is usable, exiting if it's not audio at all
+func checkAudio(osuMap types.OsuMap, data []byte) audio.Info {
+	info, warnings, err := converter.CheckAudio(osuMap, data)
+	if err != nil {
+		fmt.Printf("Error checking audio file: %v\n", err)
+		os.Exit(1)
+	}
+	if info.Format != "" {
+		fmt.Printf("Audio: %s\n", info)
+	}
+	printWarnings(warnings)
+	return info
+}
+
+// alignAudio pads or trims the audio to fit the notes, returning the new audio & how far the chart moved
+func alignAudio(osuMap *types.OsuMap, data []byte, trimSilence bool) ([]byte, int) {
+	aligned, shift, err := converter.AlignAudio(osuMap, data, trimSilence)
+	switch {
+	case err != nil:
+		fmt.Printf("Warning: couldn't line the audio up with the notes: %v\n", err)
+	case shift > 0:
+		fmt.Printf("Padded the audio with %dms of silence so no notes come before it\n", shift)
+	case shift < 0:
+		fmt.Printf("Trimmed %dms of leading silence from the audio\n", -shift)
+	}
+	return aligned, shift
+}
+
+// createBackground tints the default background, or cover art when given, with the map's background gradient
+func createBackground(sbMap types.SparebeatMap, coverArt []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(assets.Background))
+	if err != nil {
+		return nil, err
+	}
 	width, height := img.Bounds().Dx(), img.Bounds().Dy()
 
+	// the gradient is lighter over cover art so it stays recognizable
+	opacity := 0.8
+	if coverArt != nil {
+		cover, _, err := image.Decode(bytes.NewReader(coverArt))
+		if err != nil {
+			fmt.Printf("Warning: couldn't decode cover art, using the default background: %v\n", err)
+		} else {
+			img = imaging.Fill(cover, width, height, imaging.Center, imaging.Lanczos)
+			opacity = 0.5
+		}
+	}
+
 	gradient := imaging.New(width, height, color.Transparent)
-	startColor := color.NRGBA{R: 67, G: 198, B: 172, A: 255}
-	endColor := color.NRGBA{R: 25, G: 22, B: 84, A: 255}
+	startColor := utils.HexToNRGBA(utils.DefaultBgColor[0])
+	endColor := utils.HexToNRGBA(utils.DefaultBgColor[1])
 	if len(sbMap.BgColor) == 2 {
 		startColor = utils.HexToNRGBA(sbMap.BgColor[0])
 		endColor = utils.HexToNRGBA(sbMap.BgColor[1])
@@ -188,38 +844,12 @@ func main() {
 		draw.Draw(gradient, image.Rect(0, y, width, y+1), image.NewUniform(c), image.Point{}, draw.Over)
 	}
 
-	blended := imaging.Overlay(img, gradient, image.Pt(0, 0), 0.8)
-
-	backgroundPath := filepath.Join(sparebeatDir, "background.png")
-	imaging.Save(blended, backgroundPath)
-	fmt.Println("Created background image")
-
-	// zip all files into a .osz
-	files := append(diffFiles, audioFile, backgroundPath)
+	blended := imaging.Overlay(img, gradient, image.Pt(0, 0), opacity)
 
-	cwd, err := os.Getwd()
+	var buf bytes.Buffer
+	err = imaging.Encode(&buf, blended, imaging.PNG)
 	if err != nil {
-		fmt.Printf("Error getting current working directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	err = converter.ZipFiles(files, filepath.Join(cwd,
-		utils.Sanitize(fmt.Sprintf("%s - %s.osz",
-			osuMap.Metadata.Artist,
-			osuMap.Metadata.Title,
-		))),
-	)
-	if err != nil {
-		fmt.Printf("Error zipping files: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Printf("Created .osz file: %s - %s.osz\n", osuMap.Metadata.Artist, osuMap.Metadata.Title)
-
-	// clean up temp directory
-	err = os.RemoveAll(sparebeatDir)
-	if err != nil {
-		fmt.Printf("Error cleaning up temp folder: %v\n", err)
-	} else {
-		fmt.Println("Cleaned up temporary conversion folder")
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/termview"
+	"github.com/cxntered/SpareChange/pkg/types"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+func viewChart(arguments []string) {
+	flags := flag.NewFlagSet("view", flag.ExitOnError)
+	from := flags.String("from", "", "Input format, detected from the input file extension if omitted")
+	level := flags.StringP("level", "l", "", "Level to view (easy, normal or hard), defaults to the first one")
+	rowsPerBeat := flags.Int("rows-per-beat", 4, "Rows drawn per beat, notes in between snap to the nearest row")
+	ascii := flags.Bool("ascii", false, "Only use ASCII characters")
+	flags.Parse(arguments)
+
+	args := flags.Args()
+	if len(args) != 1 {
+		fmt.Println("Usage: sparechange view [options] <input>")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	inFormat, body, diff := readLevel(args[0], *from, *level)
+
+	opts := termview.Options{RowsPerBeat: *rowsPerBeat, ASCII: *ascii}
+	var lines []string
+	if inFormat.Name == "sparebeat" {
+		// draw bind zones from the Sparebeat map itself
+		var sbMap types.SparebeatMap
+		err := json.Unmarshal(body, &sbMap)
+		if err != nil {
+			fmt.Printf("Error parsing map JSON: %v\n", err)
+			os.Exit(1)
+		}
+		lines, err = termview.RenderSparebeatLevel(sbMap, diff.Metadata.Version, opts)
+		if err != nil {
+			fmt.Printf("Error rendering chart: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		lines = termview.RenderOsuFile(diff, opts)
+	}
+
+	title := fmt.Sprintf("%s - %s [%s]", diff.Metadata.Artist, diff.Metadata.Title, diff.Metadata.Version)
+
+	// page through the chart when attached to a terminal, otherwise print all of it
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Println(title)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return
+	}
+
+	err := page(title, lines, termview.MeasureStarts(lines))
+	if err != nil {
+		fmt.Printf("Error viewing chart: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// page shows a screenful of lines at a time until q is pressed, jumping between the measures starting at measures.
+// Sparebeat sections are converted into measures, so this pages through the sections too.
+func page(title string, lines []string, measures []int) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	top := 0
+	key := make([]byte, 3)
+	for {
+		_, height, err := term.GetSize(fd)
+		if err != nil {
+			return err
+		}
+		size := max(height-2, 1) // leave room for the title & status lines
+		top = max(min(top, len(lines)-size), 0)
+		bottom := min(top+size, len(lines))
+
+		// raw mode doesn't translate \n, so lines end with \r\n
+		var sb strings.Builder
+		sb.WriteString("\x1b[H\x1b[2J") // move to the top left & clear the screen
+		sb.WriteString(title + "\r\n")
+		for _, line := range lines[top:bottom] {
+			sb.WriteString(line + "\r\n")
+		}
+		measure := sort.SearchInts(measures, top+1)
+		sb.WriteString(fmt.Sprintf("\x1b[7m measure %d of %d | space/j: next measure, b/k: back, f/PgDn, PgUp: screen, g/G: start/end, q: quit \x1b[0m", measure, len(measures)))
+		fmt.Print(sb.String())
+
+		n, err := os.Stdin.Read(key)
+		if err != nil {
+			return err
+		}
+		switch string(key[:n]) {
+		case " ", "j", "\r", "\x1b[B": // down arrow
+			// the next measure, or a screenful after the last one
+			next := sort.SearchInts(measures, top+1)
+			if next < len(measures) {
+				top = measures[next]
+			} else {
+				top += size
+			}
+		case "b", "k", "\x1b[A": // up arrow
+			if previous := sort.SearchInts(measures, top) - 1; previous >= 0 {
+				top = measures[previous]
+			} else {
+				top = 0
+			}
+		case "f", "\x1b[6~": // page down
+			top += size
+		case "\x1b[5~": // page up
+			top -= size
+		case "g", "\x1b[H":
+			top = 0
+		case "G", "\x1b[F":
+			top = len(lines)
+		case "q", "\x1b", "\x03": // escape, ctrl+c
+			fmt.Print("\r\n")
+			return nil
+		}
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall/js"
 
 	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/stats"
 	"github.com/cxntered/SpareChange/pkg/types"
-	"github.com/cxntered/SpareChange/pkg/utils"
 )
 
 func main() {
@@ -15,7 +18,17 @@ func main() {
 	<-make(chan struct{}) // keep program running
 }
 
-func convertSparebeatMap(this js.Value, args []js.Value) interface{} {
+func convertSparebeatMap(this js.Value, args []js.Value) (response interface{}) {
+	// a panic would take down the whole module, so report it like any other error
+	defer func() {
+		if r := recover(); r != nil {
+			response = map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("Conversion error: %v", r),
+			}
+		}
+	}()
+
 	if len(args) < 1 {
 		return map[string]interface{}{
 			"success": false,
@@ -23,16 +36,37 @@ func convertSparebeatMap(this js.Value, args []js.Value) interface{} {
 		}
 	}
 
-	var sbMap types.SparebeatMap
-	err := json.Unmarshal([]byte(args[0].String()), &sbMap)
+	// the page converts Sparebeat maps into .osu files, but any formats in the registry work
+	from, err := converter.LookupFormat(stringOption(args[1:], "from", "sparebeat"))
+	if err == nil && !from.CanRead() {
+		err = fmt.Errorf("format %q cannot be used as input", from.Name)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	to, err := converter.LookupFormat(stringOption(args[1:], "to", "osu"))
+	if err == nil && !to.CanWrite() {
+		err = fmt.Errorf("format %q cannot be used as output", to.Name)
+	}
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
-			"error":   "Invalid map data: " + err.Error(),
+			"error":   err.Error(),
 		}
 	}
 
-	osuMap, err := converter.ConvertSparebeatToOsu(sbMap)
+	opts, err := parseOptions(args[1:])
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Invalid options: " + err.Error(),
+		}
+	}
+
+	result, err := from.Read(bytes.NewReader(inputData(args[0])), opts)
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
@@ -40,19 +74,86 @@ func convertSparebeatMap(this js.Value, args []js.Value) interface{} {
 		}
 	}
 
+	osuMap := result.Map
+	levelStats := jsStats(stats.FromResult(result))
+
+	// the page passes the audio along so it can be checked & lined up before it ends up in the .osz
+	if data := audioOption(args[1:]); data != nil && from.Name == "sparebeat" {
+		info, warnings, err := converter.CheckAudio(osuMap, data)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   "Invalid audio file: " + err.Error(),
+			}
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+
+		aligned, _, err := converter.AlignAudio(&osuMap, data, trimSilenceOption(args[1:]))
+		if err != nil {
+			result.Warnings = append(result.Warnings, converter.Warning{
+				Kind:    converter.WarningNotMP3,
+				Section: -1,
+				Row:     -1,
+				Count:   1,
+				Message: "couldn't line the audio up with the notes: " + err.Error(),
+			})
+		}
+		if osuMap.Files == nil {
+			osuMap.Files = make(map[string][]byte)
+		}
+		osuMap.Files[converter.SetAudioFilename(&osuMap, info.Format)] = aligned
+	}
+	// like the CLI, only once the audio is lined up, which can make room for early notes itself
+	if from.Name == "sparebeat" {
+		result.Warnings = append(result.Warnings, converter.ApplyLeadIn(&osuMap)...)
+	}
+
 	files := make(map[string]interface{})
-	for _, diff := range osuMap.Difficulties {
+	write := func(name string, osuMap types.OsuMap) error {
+		var buf bytes.Buffer
+		err := to.Write(osuMap, &buf)
+		if err != nil {
+			return err
+		}
+		files[name] = buf.String()
+		return nil
+	}
+	if to.PerDifficulty {
+		for _, diff := range osuMap.Difficulties {
+			err = write(fileName(converter.OsuFileName(diff), to), types.OsuMap{Difficulties: []types.OsuFile{diff}})
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		err = write(fileName(converter.OszFileName(osuMap), to), osuMap)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Failed to generate %s file: %v", to.Name, err),
+		}
+	}
+
+	if len(osuMap.Storyboard.List) > 0 {
 		var buf bytes.Buffer
-		err := converter.WriteOsuContent(diff, &buf)
+		err := converter.WriteOsbContent(osuMap.Storyboard, &buf)
 		if err != nil {
 			return map[string]interface{}{
 				"success": false,
-				"error":   "Failed to generate .osu file: " + err.Error(),
+				"error":   "Failed to generate .osb file: " + err.Error(),
 			}
 		}
 
-		fileName := diff.Metadata.Artist + " - " + diff.Metadata.Title + " (" + diff.Metadata.Creator + ") [" + diff.Metadata.Version + "].osu"
-		files[utils.Sanitize(fileName)] = buf.String()
+		files[converter.OsbFileName(osuMap)] = buf.String()
+	}
+
+	// binary files (e.g. storyboard images) are passed as Uint8Arrays
+	assets := make(map[string]interface{})
+	for name, content := range osuMap.Files {
+		array := js.Global().Get("Uint8Array").New(len(content))
+		js.CopyBytesToJS(array, content)
+		assets[name] = array
 	}
 
 	return map[string]interface{}{
@@ -60,7 +161,161 @@ func convertSparebeatMap(this js.Value, args []js.Value) interface{} {
 		"metadata": map[string]interface{}{
 			"title":  osuMap.Metadata.Title,
 			"artist": osuMap.Metadata.Artist,
+			"stats":  levelStats,
 		},
-		"files": files,
+		"files":    files,
+		"assets":   assets,
+		"warnings": jsWarnings(result.Warnings),
+	}
+}
+
+// parseOptions reads conversion options from an optional JS object, e.g. { from: "sparebeat", to: "osu", bindZones: "storyboard", storyboard: true, beta: false, preview: "densest", scroll: "faithful", offset: 0, trimSilence: false, audio: new Uint8Array(...) }
+func parseOptions(args []js.Value) (converter.Options, error) {
+	var opts converter.Options
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return opts, nil
+	}
+
+	if bindZones := args[0].Get("bindZones"); bindZones.Type() == js.TypeString && bindZones.String() != "" {
+		mode, err := converter.ParseBindZoneMode(bindZones.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.BindZones = mode
+	}
+	if scroll := args[0].Get("scroll"); scroll.Type() == js.TypeString {
+		mode, err := converter.ParseScrollMode(scroll.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.Scroll = mode
+	}
+	if storyboard := args[0].Get("storyboard"); storyboard.Type() == js.TypeBoolean {
+		opts.Storyboard = storyboard.Bool()
+	}
+	if beta := args[0].Get("beta"); beta.Type() == js.TypeBoolean {
+		opts.Beta = beta.Bool()
+	}
+	if breakThreshold := args[0].Get("breakThreshold"); breakThreshold.Type() == js.TypeNumber {
+		opts.BreakThreshold = breakThreshold.Int()
+	}
+	if offset := args[0].Get("offset"); offset.Type() == js.TypeNumber {
+		opts.Offset = offset.Int()
+	}
+	// the preview point is either a mode or a time in milliseconds
+	switch preview := args[0].Get("preview"); preview.Type() {
+	case js.TypeNumber:
+		opts.Preview = converter.PreviewTime
+		opts.PreviewTime = preview.Int()
+	case js.TypeString:
+		mode, err := converter.ParsePreviewMode(preview.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.Preview = mode
+	}
+
+	return opts, nil
+}
+
+// inputData reads the map to convert, a string for text formats or a Uint8Array for binary ones like .osz
+func inputData(value js.Value) []byte {
+	if value.Type() != js.TypeObject || !value.InstanceOf(js.Global().Get("Uint8Array")) {
+		return []byte(value.String())
+	}
+	data := make([]byte, value.Get("length").Int())
+	js.CopyBytesToGo(data, value)
+	return data
+}
+
+// fileName gives a file the format's extension, keeping the one it has for formats without extensions
+func fileName(name string, format converter.Format) string {
+	if len(format.Extensions) == 0 {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + format.Extensions[0]
+}
+
+// stringOption reads a string field of the options object, falling back to def when it isn't set
+func stringOption(args []js.Value, name string, def string) string {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return def
+	}
+	value := args[0].Get(name)
+	if value.Type() != js.TypeString || value.String() == "" {
+		return def
+	}
+	return value.String()
+}
+
+// audioOption reads the audio file from the options object's audio field, a Uint8Array
+func audioOption(args []js.Value) []byte {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return nil
+	}
+	array := args[0].Get("audio")
+	if array.Type() != js.TypeObject || !array.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil
+	}
+	data := make([]byte, array.Get("length").Int())
+	js.CopyBytesToGo(data, array)
+	return data
+}
+
+func trimSilenceOption(args []js.Value) bool {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return false
+	}
+	trimSilence := args[0].Get("trimSilence")
+	return trimSilence.Type() == js.TypeBoolean && trimSilence.Bool()
+}
+
+// jsStats converts level stats by hand, as js.ValueOf only takes plain maps & slices
+func jsStats(levels []stats.LevelStats) []interface{} {
+	list := make([]interface{}, 0, len(levels))
+	for _, level := range levels {
+		chords := make(map[string]interface{})
+		for size, count := range level.Chords {
+			chords[strconv.Itoa(size)] = count
+		}
+
+		patterns := make([]interface{}, 0, len(level.Patterns))
+		for _, pattern := range level.Patterns {
+			patterns = append(patterns, string(pattern))
+		}
+
+		list = append(list, map[string]interface{}{
+			"level":        level.Level,
+			"notes":        level.Notes,
+			"holds":        level.Holds,
+			"attackNotes":  level.AttackNotes,
+			"duration":     level.Duration,
+			"peakNps":      level.PeakNPS,
+			"averageNps":   level.AverageNPS,
+			"chords":       chords,
+			"minBpm":       level.MinBPM,
+			"maxBpm":       level.MaxBPM,
+			"speedChanges": level.SpeedChanges,
+			"bindZoneTime": level.BindZoneTime,
+			"patterns":     patterns,
+		})
+	}
+	return list
+}
+
+func jsWarnings(warnings []converter.Warning) []interface{} {
+	list := make([]interface{}, 0, len(warnings))
+	for _, warning := range warnings {
+		list = append(list, map[string]interface{}{
+			"kind":    string(warning.Kind),
+			"level":   warning.Level,
+			"section": warning.Section,
+			"row":     warning.Row,
+			"time":    warning.Time,
+			"count":   warning.Count,
+			"message": warning.Message,
+			"text":    warning.String(),
+		})
 	}
+	return list
 }
@@ -7,4 +7,10 @@ require (
 	github.com/spf13/pflag v1.0.7
 )
 
-require golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8 // indirect
+require (
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	golang.org/x/term v0.30.0
+)
+
+require golang.org/x/sys v0.31.0 // indirect
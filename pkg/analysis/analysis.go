@@ -0,0 +1,240 @@
+// Package analysis classifies the measures of a chart into common osu!mania patterns.
+package analysis
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+type Pattern string
+
+const (
+	PatternNone       Pattern = "none" // too sparse to call it anything
+	PatternStream     Pattern = "stream"
+	PatternJumpstream Pattern = "jumpstream"
+	PatternHandstream Pattern = "handstream"
+	PatternJacks      Pattern = "jacks"
+	PatternChordjacks Pattern = "chordjacks"
+	PatternTrills     Pattern = "trills"
+	PatternRolls      Pattern = "rolls"
+	PatternLongNotes  Pattern = "long-notes"
+)
+
+const (
+	minRowsPerBeat   = 2    // anything slower than 8ths is too sparse for a pattern
+	longNoteRatio    = 0.5  // of the notes in a measure being holds
+	jackRatio        = 0.5  // of consecutive rows sharing a column
+	chordRatio       = 0.25 // of rows being jumps or hands
+	sequenceRatio    = 0.6  // of rows continuing a trill or roll
+	dominantShare    = 0.2  // of a level's notes for a pattern to be dominant
+	maxDominant      = 3
+	minMeasureLength = 1 // ms, measures can't get any shorter
+)
+
+// Measure annotates one measure of a chart
+type Measure struct {
+	Index   int     `json:"index"` // 1-based, as in the terminal viewer
+	Start   int     `json:"start"`
+	End     int     `json:"end"`
+	Notes   int     `json:"notes"`
+	Pattern Pattern `json:"pattern"`
+}
+
+// Report is the analysis of a single level
+type Report struct {
+	Level    string    `json:"level"`
+	Measures []Measure `json:"measures"`
+	Dominant []Pattern `json:"dominant"` // most common patterns by note count, most common first
+}
+
+// Analyze splits a level into measures along its uninherited timing points & classifies each of them
+func Analyze(osuFile types.OsuFile) Report {
+	report := Report{Level: osuFile.Metadata.Version}
+
+	hitObjects := append([]types.HitObject(nil), osuFile.HitObjects.List...)
+	sort.SliceStable(hitObjects, func(i, j int) bool {
+		return hitObjects[i].Time < hitObjects[j].Time
+	})
+
+	bounds := measureBounds(osuFile.TimingPoints.List, hitObjects)
+	next := 0
+	for i, bound := range bounds {
+		measure := Measure{Index: i + 1, Start: int(bound.start), End: int(bound.end)}
+
+		first := next
+		for next < len(hitObjects) && float64(hitObjects[next].Time) < bound.end {
+			next++
+		}
+		measure.Notes = next - first
+		measure.Pattern = classify(hitObjects[first:next], bound.beats)
+		report.Measures = append(report.Measures, measure)
+	}
+
+	report.Dominant = dominant(report.Measures)
+	return report
+}
+
+// FromOsuMap analyzes every level of a map
+func FromOsuMap(osuMap types.OsuMap) []Report {
+	var reports []Report
+	for _, diff := range osuMap.Difficulties {
+		reports = append(reports, Analyze(diff))
+	}
+	return reports
+}
+
+type bound struct {
+	start, end float64
+	beats      float64
+}
+
+// measureBounds lays out measures from the first note or timing point to the last note
+func measureBounds(timingPoints []types.TimingPoint, hitObjects []types.HitObject) []bound {
+	var redLines []types.TimingPoint
+	for _, timingPoint := range timingPoints {
+		if timingPoint.Uninherited && timingPoint.BeatLength > 0 {
+			redLines = append(redLines, timingPoint)
+		}
+	}
+	sort.SliceStable(redLines, func(i, j int) bool {
+		return redLines[i].Time < redLines[j].Time
+	})
+	if len(redLines) == 0 || len(hitObjects) == 0 {
+		return nil
+	}
+
+	start := math.Min(float64(redLines[0].Time), float64(hitObjects[0].Time))
+	end := float64(hitObjects[len(hitObjects)-1].Time)
+
+	var bounds []bound
+	for i, redLine := range redLines {
+		beats := float64(max(redLine.Meter, 1))
+		length := math.Max(redLine.BeatLength*beats, minMeasureLength)
+
+		from := float64(redLine.Time)
+		if len(bounds) == 0 {
+			// extend the first measures backwards to cover notes before the first timing point
+			from -= math.Ceil((from-start)/length) * length
+		}
+		until := end + 1 // so the last note gets a measure too
+		if i+1 < len(redLines) {
+			until = float64(redLines[i+1].Time)
+		}
+
+		for t := from; t < until; t += length {
+			// a timing point in the middle of a measure cuts it short
+			measureEnd := t + length
+			if i+1 < len(redLines) {
+				measureEnd = math.Min(measureEnd, until)
+			}
+			bounds = append(bounds, bound{start: t, end: measureEnd, beats: (measureEnd - t) / redLine.BeatLength})
+		}
+	}
+	return bounds
+}
+
+// classify picks the pattern that best describes the notes of one measure
+func classify(hitObjects []types.HitObject, beats float64) Pattern {
+	// group notes starting at the same time into rows of column bitmasks
+	var rows []uint8
+	holds := 0
+	for i, hitObject := range hitObjects {
+		lane := min(max(int(hitObject.XPosition)*4/512, 0), 3)
+		if i == 0 || hitObject.Time != hitObjects[i-1].Time {
+			rows = append(rows, 0)
+		}
+		rows[len(rows)-1] |= 1 << lane
+		if hitObject.Type&types.HoldNote != 0 {
+			holds++
+		}
+	}
+
+	if len(rows) < 2 || float64(len(rows)) < beats*minRowsPerBeat {
+		return PatternNone
+	}
+	if float64(holds)/float64(len(hitObjects)) >= longNoteRatio {
+		return PatternLongNotes
+	}
+
+	jacks, trills, rolls := 0, 0, 0
+	jumps, hands := 0, 0
+	for i, row := range rows {
+		switch size := bits.OnesCount8(row); {
+		case size >= 3:
+			hands++
+		case size == 2:
+			jumps++
+		}
+
+		if i >= 1 && row&rows[i-1] != 0 {
+			jacks++
+		}
+		// trills alternate between two sets of columns: a b a b
+		if i >= 2 && row == rows[i-2] && row&rows[i-1] == 0 {
+			trills++
+		}
+		// rolls move through adjacent columns in one direction: 1 2 3 4 or 4 3 2 1
+		if i >= 2 && bits.OnesCount8(row|rows[i-1]|rows[i-2]) == 3 && isStep(rows[i-2], rows[i-1], row) {
+			rolls++
+		}
+	}
+
+	transitions := float64(len(rows) - 1)
+	switch {
+	case float64(jacks)/transitions >= jackRatio:
+		if float64(len(hitObjects))/float64(len(rows)) >= 2 {
+			return PatternChordjacks
+		}
+		return PatternJacks
+	case float64(hands)/float64(len(rows)) >= chordRatio:
+		return PatternHandstream
+	case float64(jumps)/float64(len(rows)) >= chordRatio:
+		return PatternJumpstream
+	case len(rows) > 2 && float64(trills)/float64(len(rows)-2) >= sequenceRatio:
+		return PatternTrills
+	case len(rows) > 2 && float64(rolls)/float64(len(rows)-2) >= sequenceRatio:
+		return PatternRolls
+	}
+	return PatternStream
+}
+
+// isStep reports whether three single notes move one column at a time in the same direction
+func isStep(a uint8, b uint8, c uint8) bool {
+	if bits.OnesCount8(a) != 1 || bits.OnesCount8(b) != 1 || bits.OnesCount8(c) != 1 {
+		return false
+	}
+	return (b == a<<1 && c == b<<1) || (b == a>>1 && c == b>>1)
+}
+
+// dominant ranks patterns by how many notes are in measures of that pattern
+func dominant(measures []Measure) []Pattern {
+	notes := make(map[Pattern]int)
+	total := 0
+	for _, measure := range measures {
+		total += measure.Notes
+		if measure.Pattern != PatternNone {
+			notes[measure.Pattern] += measure.Notes
+		}
+	}
+
+	patterns := []Pattern{}
+	for pattern, count := range notes {
+		if float64(count) >= float64(total)*dominantShare {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if notes[patterns[i]] != notes[patterns[j]] {
+			return notes[patterns[i]] > notes[patterns[j]]
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	if len(patterns) > maxDominant {
+		patterns = patterns[:maxDominant]
+	}
+	return patterns
+}
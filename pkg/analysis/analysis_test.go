@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// chart builds a 120 BPM level with one row of columns (e.g. "13") per 16th note
+func chart(rows []string, holds bool) types.OsuFile {
+	var osuFile types.OsuFile
+	osuFile.TimingPoints.List = []types.TimingPoint{{Time: 0, BeatLength: 500, Meter: 4, Uninherited: true}}
+	for i, row := range rows {
+		for _, column := range row {
+			hitObject := types.HitObject{
+				XPosition: int16(column-'1')*128 + 64,
+				Time:      i * 125,
+				Type:      types.HitCircle,
+			}
+			if holds {
+				hitObject.Type = types.HoldNote
+				hitObject.ObjectParams.EndTime = hitObject.Time + 100
+			}
+			osuFile.HitObjects.List = append(osuFile.HitObjects.List, hitObject)
+		}
+	}
+	return osuFile
+}
+
+func repeat(rows []string, times int) []string {
+	var list []string
+	for range times {
+		list = append(list, rows...)
+	}
+	return list
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []string
+		holds bool
+		want  Pattern
+	}{
+		{name: "stream", rows: repeat([]string{"1", "3", "2", "4", "3", "1", "4", "2"}, 2), want: PatternStream},
+		{name: "jumpstream", rows: repeat([]string{"13", "2", "4", "1", "24", "3", "1", "4"}, 2), want: PatternJumpstream},
+		{name: "handstream", rows: repeat([]string{"124", "3", "1", "4", "123", "4", "2", "3"}, 2), want: PatternHandstream},
+		{name: "jacks", rows: repeat([]string{"1", "1", "1", "1", "3", "3", "3", "3"}, 2), want: PatternJacks},
+		{name: "chordjacks", rows: repeat([]string{"12", "12", "13", "13", "34", "34", "24", "24"}, 2), want: PatternChordjacks},
+		{name: "trills", rows: repeat([]string{"1", "2"}, 8), want: PatternTrills},
+		{name: "rolls", rows: repeat([]string{"1", "2", "3", "4", "3", "2"}, 3)[:16], want: PatternRolls},
+		{name: "long notes", rows: repeat([]string{"1", "3", "2", "4"}, 4), holds: true, want: PatternLongNotes},
+		{name: "sparse", rows: []string{"1", "", "", "", "2", "", "", "", "3", "", "", "", "4", "", "", ""}, want: PatternNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Analyze(chart(tt.rows, tt.holds))
+			if len(report.Measures) != 1 {
+				t.Fatalf("got %d measures, want 1: %+v", len(report.Measures), report.Measures)
+			}
+			if got := report.Measures[0].Pattern; got != tt.want {
+				t.Errorf("pattern = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDominant(t *testing.T) {
+	rows := append(repeat([]string{"1", "3", "2", "4"}, 8), repeat([]string{"13", "2", "4", "1", "24", "3", "1", "4"}, 2)...)
+	rows = append(rows, repeat([]string{"1", "2"}, 2)...)
+
+	report := Analyze(chart(rows, false))
+	want := []Pattern{PatternStream, PatternJumpstream}
+	if !reflect.DeepEqual(report.Dominant, want) {
+		t.Errorf("dominant = %v, want %v (measures %+v)", report.Dominant, want, report.Measures)
+	}
+}
@@ -0,0 +1,152 @@
+package audio
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrNotLayerIII means the MP3 uses an older layer, whose frames can't be checked for silence
+var ErrNotLayerIII = errors.New("only MPEG Layer III audio can be trimmed")
+
+// decoderDelay is the delay of an MP3 decoder's filter bank, which players skip along with the encoder delay
+const decoderDelay = 529
+
+// PadMP3 prepends at least ms milliseconds of silent frames, returning the new file & how much later the audio
+// now plays, rounded to the nearest millisecond. Frames are copied as they are, without re-encoding.
+// The Xing frame is dropped as its frame count would be wrong, see gaplessDelay.
+func PadMP3(data []byte, ms int) ([]byte, int, error) {
+	info, frames, err := scan(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ms <= 0 || len(frames) == 0 {
+		return data, 0, nil
+	}
+
+	h := frames[0].header
+	count := int(math.Ceil(float64(ms) * float64(h.SampleRate) / 1000 / float64(h.Samples)))
+
+	// an all zero frame is silent in every layer: nothing is allocated & no data comes from earlier frames
+	header := append([]byte(nil), data[frames[0].offset:frames[0].offset+4]...)
+	header[1] |= 0x01  // no checksum
+	header[2] &^= 0x02 // no padding
+	silent, _ := ParseFrameHeader(header)
+	frame := make([]byte, silent.Length)
+	copy(frame, header)
+
+	out := make([]byte, 0, len(data)+count*len(frame))
+	out = append(out, data[:info.AudioStart]...)
+	for range count {
+		out = append(out, frame...)
+	}
+	out = append(out, data[frames[0].offset:]...)
+	return out, sampleTime(count*h.Samples+gaplessDelay(info), h), nil
+}
+
+// TrimMP3 drops silent frames from the start, but no more than maxMs milliseconds of them, returning the new file
+// & how much earlier the audio now plays, rounded to the nearest millisecond. Like PadMP3, it works on whole frames
+// & drops the Xing frame.
+func TrimMP3(data []byte, maxMs int) ([]byte, int, error) {
+	info, frames, err := scan(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(frames) == 0 {
+		return data, 0, nil
+	}
+	h := frames[0].header
+	if h.Layer != 3 {
+		return nil, 0, ErrNotLayerIII
+	}
+
+	first := 0
+	for first < len(frames) && silent(data[frames[first].offset:], frames[first].header) {
+		first++
+	}
+	maxFrames := int(float64(max(maxMs, 0)) * float64(h.SampleRate) / 1000 / float64(h.Samples))
+	first = min(first, maxFrames, len(frames)-1)
+
+	// Layer III frames can keep their data in the frames before them (the "bit reservoir"), so keep those too
+	cut := first
+	for need := mainDataBegin(data[frames[first].offset:], h); cut > 0 && need > 0; {
+		cut--
+		previous := frames[cut].header
+		need -= previous.Length - sideInfoStart(previous) - sideInfoSize(previous)
+	}
+	if cut == 0 {
+		return data, 0, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:info.AudioStart]...)
+	out = append(out, data[frames[cut].offset:]...)
+	return out, sampleTime(cut*h.Samples-gaplessDelay(info), h), nil
+}
+
+// gaplessDelay is how many samples players that read the LAME tag skip at the start. The tag goes along with
+// the Xing frame, so those samples play again once it's dropped & the audio starts that much later.
+func gaplessDelay(info MP3Info) int {
+	if info.Encoder == "" {
+		return 0
+	}
+	return info.EncoderDelay + decoderDelay
+}
+
+// sampleTime is how long a number of samples play for, in milliseconds
+func sampleTime(samples int, h FrameHeader) int {
+	return int(math.Round(float64(samples) * 1000 / float64(h.SampleRate)))
+}
+
+// silent reports whether a Layer III frame holds no audio data at all, which is how encoders store digital silence
+func silent(frame []byte, h FrameHeader) bool {
+	start := sideInfoStart(h)
+	if len(frame) < start+sideInfoSize(h) {
+		return false
+	}
+	sideInfo := frame[start:]
+
+	// the side information starts with a pointer into the bit reservoir & private bits,
+	// then each granule & channel starts with the length of its data
+	pos, granules, granuleSize := 8, 1, 63
+	if h.Channels == 1 {
+		pos += 1
+	} else {
+		pos += 2
+	}
+	if h.Version == 1 {
+		pos, granules, granuleSize = 9+3, 2, 59
+		if h.Channels == 1 {
+			pos = 9 + 5
+		}
+		pos += 4 * h.Channels // scale factor selection
+	}
+
+	for range granules * h.Channels {
+		if readBits(sideInfo, pos, 12) != 0 {
+			return false
+		}
+		pos += granuleSize
+	}
+	return true
+}
+
+// mainDataBegin is how many bytes of a Layer III frame's data are in the frames before it
+func mainDataBegin(frame []byte, h FrameHeader) int {
+	start := sideInfoStart(h)
+	if len(frame) < start+2 {
+		return 0
+	}
+	if h.Version == 1 {
+		return readBits(frame[start:], 0, 9)
+	}
+	return readBits(frame[start:], 0, 8)
+}
+
+// readBits reads a big endian number of n bits, starting pos bits into b
+func readBits(b []byte, pos int, n int) int {
+	value := 0
+	for i := pos; i < pos+n; i++ {
+		value = value<<1 | int(b[i/8]>>(7-i%8)&1)
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// audible returns frames whose side information says they hold data, reaching reservoir bytes into earlier frames
+func audible(n int, reservoir int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, header)
+	frame[4] = byte(reservoir >> 1)
+	frame[5] = byte(reservoir << 7)
+	frame[7] = 0xff // part of the first granule's data length
+	return bytes.Repeat(frame, n)
+}
+
+func TestPadMP3(t *testing.T) {
+	tag := id3v2(20)
+	data := append(append(append([]byte(nil), tag...), xingFrame(0, 0)...), audible(10, 0)...)
+
+	padded, ms, err := PadMP3(data, 100)
+	if err != nil {
+		t.Fatalf("PadMP3() error: %v", err)
+	}
+	// 4 frames of 1152 samples at 44100 Hz, plus the 529 samples of decoder delay the LAME tag skipped
+	if ms != 116 {
+		t.Errorf("PadMP3() added %dms, want 116ms", ms)
+	}
+	if !bytes.HasPrefix(padded, tag) {
+		t.Error("PadMP3() lost the ID3v2 tag")
+	}
+	if !bytes.HasSuffix(padded, audible(10, 0)) {
+		t.Error("PadMP3() changed the original frames")
+	}
+
+	info, err := ScanMP3(padded)
+	if err != nil {
+		t.Fatalf("ScanMP3(padded) error: %v", err)
+	}
+	if info.Frames != 14 || info.Xing {
+		t.Errorf("padded file has %d frames (Xing %v), want 14 without a Xing frame", info.Frames, info.Xing)
+	}
+}
+
+func TestTrimMP3(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		maxMs     int
+		wantMs    int
+		wantFrame int // frames left
+	}{
+		{name: "leading silence", data: append(frames(5), audible(5, 0)...), maxMs: 10000, wantMs: 131, wantFrame: 5},
+		{name: "limited", data: append(frames(5), audible(5, 0)...), maxMs: 60, wantMs: 52, wantFrame: 8},
+		{name: "bit reservoir", data: append(frames(5), audible(5, 500)...), maxMs: 10000, wantMs: 78, wantFrame: 7},
+		{name: "no silence", data: audible(5, 0), maxMs: 10000, wantMs: 0, wantFrame: 5},
+		// the 576 + 529 samples of delay the LAME tag skipped play again without it
+		{name: "LAME tag", data: append(append(xingFrame(576, 0), frames(5)...), audible(5, 0)...), maxMs: 10000, wantMs: 106, wantFrame: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmed, ms, err := TrimMP3(tt.data, tt.maxMs)
+			if err != nil {
+				t.Fatalf("TrimMP3() error: %v", err)
+			}
+			info, err := ScanMP3(trimmed)
+			if err != nil {
+				t.Fatalf("ScanMP3(trimmed) error: %v", err)
+			}
+			if ms != tt.wantMs || info.Frames != tt.wantFrame {
+				t.Errorf("TrimMP3() cut %dms leaving %d frames, want %dms leaving %d", ms, info.Frames, tt.wantMs, tt.wantFrame)
+			}
+		})
+	}
+
+	// MPEG 1 Layer II
+	layer2 := bytes.Repeat(append([]byte{0xff, 0xfd, 0x90, 0x00}, make([]byte, 518)...), 3)
+	if _, _, err := TrimMP3(layer2, 1000); !errors.Is(err, ErrNotLayerIII) {
+		t.Errorf("TrimMP3(Layer II) error = %v, want %v", err, ErrNotLayerIII)
+	}
+}
@@ -0,0 +1,229 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format is an audio container format
+type Format string
+
+const (
+	FormatMP3  Format = "mp3"
+	FormatOGG  Format = "ogg"
+	FormatWAV  Format = "wav"
+	FormatFLAC Format = "flac"
+	FormatM4A  Format = "m4a"
+)
+
+// ErrUnknownFormat means the data isn't in any format Probe knows
+var ErrUnknownFormat = errors.New("unknown audio format")
+
+// Extension is the file extension for the format, including the dot
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Playable reports whether osu! can play the format
+func (f Format) Playable() bool {
+	return f == FormatMP3 || f == FormatOGG
+}
+
+// Info describes an audio file of any known format
+type Info struct {
+	Format     Format
+	Codec      string // the codec inside an OGG container, "vorbis" or "opus"
+	Duration   int    // ms, 0 if unknown
+	SampleRate int    // Hz
+	Channels   int
+
+	MP3 MP3Info // only for MP3 files
+}
+
+func (i Info) String() string {
+	if i.Format == FormatMP3 {
+		return "MP3, " + i.MP3.String()
+	}
+	s := strings.ToUpper(string(i.Format))
+	if i.Codec != "" {
+		s += " (" + i.Codec + ")"
+	}
+	return fmt.Sprintf("%s, %d:%02d, %d Hz", s, i.Duration/60000, i.Duration/1000%60, i.SampleRate)
+}
+
+// Probe works out the format of an audio file from its contents & reads its duration
+func Probe(data []byte) (Info, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return probeOGG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return probeWAV(data)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return probeFLAC(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return probeM4A(data)
+	}
+
+	mp3, err := ScanMP3(data)
+	if errors.Is(err, ErrNotMP3) {
+		return Info{}, ErrUnknownFormat
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Format: FormatMP3, Duration: mp3.Duration, SampleRate: mp3.SampleRate, Channels: mp3.Channels, MP3: mp3}, nil
+}
+
+// probeOGG reads the codec from the first page & the duration from the last one's granule position
+func probeOGG(data []byte) (Info, error) {
+	info := Info{Format: FormatOGG}
+	payload, _, ok := oggPage(data)
+	if !ok {
+		return info, fmt.Errorf("invalid OGG page")
+	}
+
+	preSkip := 0
+	switch {
+	case len(payload) >= 16 && string(payload[:7]) == "\x01vorbis":
+		info.Codec = "vorbis"
+		info.Channels = int(payload[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(payload[12:]))
+	case len(payload) >= 16 && string(payload[:8]) == "OpusHead":
+		// Opus always runs at 48 kHz, whatever the input was
+		info.Codec = "opus"
+		info.Channels = int(payload[9])
+		info.SampleRate = 48000
+		preSkip = int(binary.LittleEndian.Uint16(payload[10:]))
+	default:
+		return info, fmt.Errorf("OGG file has no Vorbis or Opus stream")
+	}
+	if info.SampleRate <= 0 {
+		return info, fmt.Errorf("OGG file has an invalid sample rate of %d Hz", info.SampleRate)
+	}
+
+	// the last page says how many samples came before its end
+	for i := bytes.LastIndex(data, []byte("OggS")); i > 0; i = bytes.LastIndex(data[:i], []byte("OggS")) {
+		if _, granule, ok := oggPage(data[i:]); ok && granule >= 0 {
+			info.Duration = int(max(granule-int64(preSkip), 0) * 1000 / int64(info.SampleRate))
+			break
+		}
+	}
+	return info, nil
+}
+
+// oggPage returns the payload & granule position of the page at the start of b
+func oggPage(b []byte) ([]byte, int64, bool) {
+	if len(b) < 27 || string(b[:4]) != "OggS" {
+		return nil, 0, false
+	}
+	granule := int64(binary.LittleEndian.Uint64(b[6:]))
+	segments := int(b[26])
+	if len(b) < 27+segments {
+		return nil, 0, false
+	}
+	size := 0
+	for _, lacing := range b[27 : 27+segments] {
+		size += int(lacing)
+	}
+	start := 27 + segments
+	return b[start:min(start+size, len(b))], granule, true
+}
+
+// probeWAV reads the format & data chunks of a RIFF file
+func probeWAV(data []byte) (Info, error) {
+	info := Info{Format: FormatWAV}
+	byteRate := 0
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+		switch {
+		case id == "fmt " && len(body) >= 12:
+			info.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			byteRate = int(binary.LittleEndian.Uint32(body[8:]))
+		case id == "data" && byteRate > 0:
+			info.Duration = int(int64(size) * 1000 / int64(byteRate))
+			return info, nil
+		}
+		pos += 8 + size + size%2 // chunks are padded to an even size
+	}
+	if byteRate == 0 {
+		return info, fmt.Errorf("WAV file has no format chunk")
+	}
+	return info, nil
+}
+
+// probeFLAC reads the STREAMINFO block, which always comes first
+func probeFLAC(data []byte) (Info, error) {
+	info := Info{Format: FormatFLAC}
+	if len(data) < 8+18 || data[4]&0x7f != 0 {
+		return info, fmt.Errorf("FLAC file has no STREAMINFO block")
+	}
+	// sample rate (20 bits), channels - 1 (3 bits), bits per sample - 1 (5 bits), total samples (36 bits)
+	fields := binary.BigEndian.Uint64(data[8+10:])
+	info.SampleRate = int(fields >> 44)
+	info.Channels = int(fields>>41&0x07) + 1
+	samples := int64(fields & (1<<36 - 1))
+	if info.SampleRate > 0 {
+		info.Duration = int(samples * 1000 / int64(info.SampleRate))
+	}
+	return info, nil
+}
+
+// probeM4A reads the duration from the movie header (moov/mvhd)
+func probeM4A(data []byte) (Info, error) {
+	info := Info{Format: FormatM4A}
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		return info, nil // the moov box can come after the media data of a truncated file
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return info, nil
+	}
+
+	var timescale, duration int64
+	if mvhd[0] == 1 && len(mvhd) >= 32 {
+		timescale = int64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = int64(binary.BigEndian.Uint64(mvhd[24:]))
+	} else {
+		timescale = int64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = int64(binary.BigEndian.Uint32(mvhd[16:]))
+	}
+	if timescale > 0 {
+		info.Duration = int(duration * 1000 / timescale)
+	}
+	return info, nil
+}
+
+// findBox returns the contents of the first MP4 box of a type among the boxes in b
+func findBox(b []byte, boxType string) ([]byte, bool) {
+	for pos := 0; pos+8 <= len(b); {
+		size := int64(binary.BigEndian.Uint32(b[pos:]))
+		header := int64(8)
+		switch size {
+		case 0:
+			size = int64(len(b) - pos) // the box runs to the end of the file
+		case 1:
+			if pos+16 > len(b) {
+				return nil, false
+			}
+			size = int64(binary.BigEndian.Uint64(b[pos+8:]))
+			header = 16
+		}
+		// a size past the end would be a truncated or corrupt file, & could overflow the end offset
+		if size < header || size > int64(len(b)-pos) {
+			return nil, false
+		}
+		end := int64(pos) + size
+		if string(b[pos+4:pos+8]) == boxType {
+			return b[int64(pos)+header : end], true
+		}
+		pos = int(end)
+	}
+	return nil, false
+}
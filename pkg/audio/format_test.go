@@ -0,0 +1,166 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func oggPageBytes(granule int64, payload []byte) []byte {
+	page := make([]byte, 27, 28+len(payload))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	page[26] = 1
+	page = append(page, byte(len(payload)))
+	return append(page, payload...)
+}
+
+func vorbisOGG(rate int, samples int64) []byte {
+	ident := make([]byte, 30)
+	copy(ident, "\x01vorbis")
+	ident[11] = 2
+	binary.LittleEndian.PutUint32(ident[12:], uint32(rate))
+	data := oggPageBytes(0, ident)
+	data = append(data, oggPageBytes(-1, make([]byte, 100))...) // a page that ends mid packet
+	data = append(data, oggPageBytes(samples, make([]byte, 100))...)
+	return data
+}
+
+func opusOGG(samples int64) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8], head[9] = 1, 2
+	binary.LittleEndian.PutUint16(head[10:], 312)
+	return append(oggPageBytes(0, head), oggPageBytes(samples+312, make([]byte, 10))...)
+}
+
+func wav(rate int, seconds int) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WAVE")
+	data = append(data, []byte("LIST\x03\x00\x00\x00abc\x00")...) // odd sized chunks are padded
+	fmtChunk := make([]byte, 24)
+	copy(fmtChunk, "fmt ")
+	binary.LittleEndian.PutUint32(fmtChunk[4:], 16)
+	binary.LittleEndian.PutUint16(fmtChunk[8:], 1) // PCM
+	binary.LittleEndian.PutUint16(fmtChunk[10:], 2)
+	binary.LittleEndian.PutUint32(fmtChunk[12:], uint32(rate))
+	binary.LittleEndian.PutUint32(fmtChunk[16:], uint32(rate*4))
+	binary.LittleEndian.PutUint16(fmtChunk[20:], 4)
+	binary.LittleEndian.PutUint16(fmtChunk[22:], 16)
+	data = append(data, fmtChunk...)
+	dataChunk := make([]byte, 8)
+	copy(dataChunk, "data")
+	binary.LittleEndian.PutUint32(dataChunk[4:], uint32(rate*4*seconds))
+	return append(data, dataChunk...) // the samples themselves aren't needed
+}
+
+func flac(rate int, samples int64) []byte {
+	data := []byte("fLaC\x80\x00\x00\x22")
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:], uint64(rate)<<44|1<<41|15<<36|uint64(samples))
+	return append(data, streamInfo...)
+}
+
+func box(boxType string, contents ...[]byte) []byte {
+	size := 8
+	for _, c := range contents {
+		size += len(c)
+	}
+	b := binary.BigEndian.AppendUint32(nil, uint32(size))
+	b = append(b, boxType...)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func m4a(timescale int, duration int) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], uint32(timescale))
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration))
+	return append(box("ftyp", []byte("M4A \x00\x00\x00\x00")), append(box("mdat", make([]byte, 50)), box("moov", box("mvhd", mvhd))...)...)
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Info
+		wantErr error
+	}{
+		{
+			name: "MP3",
+			data: frames(100),
+			want: Info{Format: FormatMP3, Duration: 2612, SampleRate: 44100, Channels: 2, MP3: MP3Info{Duration: 2612, Bitrate: 127, SampleRate: 44100, Channels: 2, Frames: 100, FrameSamples: 1152}},
+		},
+		{
+			name: "OGG Vorbis",
+			data: vorbisOGG(44100, 44100*95),
+			want: Info{Format: FormatOGG, Codec: "vorbis", Duration: 95000, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "OGG Opus",
+			data: opusOGG(48000 * 3),
+			want: Info{Format: FormatOGG, Codec: "opus", Duration: 3000, SampleRate: 48000, Channels: 2},
+		},
+		{
+			name: "WAV",
+			data: wav(48000, 4),
+			want: Info{Format: FormatWAV, Duration: 4000, SampleRate: 48000, Channels: 2},
+		},
+		{
+			name: "FLAC",
+			data: flac(96000, 96000*125/10),
+			want: Info{Format: FormatFLAC, Duration: 12500, SampleRate: 96000, Channels: 2},
+		},
+		{
+			name: "M4A",
+			data: m4a(44100, 44100*61),
+			want: Info{Format: FormatM4A, Duration: 61000},
+		},
+		{
+			name:    "unknown",
+			data:    make([]byte, 2000),
+			wantErr: ErrUnknownFormat,
+		},
+		{
+			name:    "error page",
+			data:    []byte(`{"error": "not found"}`),
+			wantErr: ErrErrorPage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Probe() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeBrokenHeaders(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"OGG":                         []byte("OggS\x00\x02"),
+		"OGG with a sample rate of 0": vorbisOGG(0, 44100),
+		"WAV":                         []byte("RIFF\x00\x00\x00\x00WAVE"),
+		"FLAC":                        []byte("fLaC\x00\x00"),
+	} {
+		if _, err := Probe(data); err == nil {
+			t.Errorf("Probe(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestProbeBoxSizePastTheEnd(t *testing.T) {
+	// a 64 bit box size close to the largest int64
+	data := append(box("ftyp", []byte("M4A \x00\x00\x00\x00")), "\x00\x00\x00\x01free\x7f\xff\xff\xff\xff\xff\xff\xf8"...)
+	data = append(data, make([]byte, 8)...)
+	info, err := Probe(data)
+	if err != nil || info.Format != FormatM4A || info.Duration != 0 {
+		t.Errorf("Probe() = %+v, %v, want an M4A file without a duration", info, err)
+	}
+}
@@ -0,0 +1,250 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tags holds the ID3v2 tags SpareChange uses
+type Tags struct {
+	Title  string
+	Artist string
+	Album  string
+	Genre  string
+
+	Cover     []byte // front cover, or any picture when there's none
+	CoverMIME string
+}
+
+// frame IDs by ID3v2 version, 2.2 uses shorter ones
+var frameIDs = map[string][2]string{
+	"title":  {"TT2", "TIT2"},
+	"artist": {"TP1", "TPE1"},
+	"album":  {"TAL", "TALB"},
+	"genre":  {"TCO", "TCON"},
+	"cover":  {"PIC", "APIC"},
+}
+
+const frontCover = 3 // picture type
+
+// ReadID3v2 reads the ID3v2 tag at the start of an MP3 file, returning false when there is none
+func ReadID3v2(data []byte) (Tags, bool) {
+	var tags Tags
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return tags, false
+	}
+
+	version := int(data[3])
+	flags := data[5]
+	size := syncsafe(data[6:10])
+	if version < 2 || version > 4 || len(data) < 10+size {
+		return tags, false
+	}
+	body := data[10 : 10+size]
+
+	// unsynchronisation inserts a 0 after every 0xff, 2.4 does it per frame instead
+	if flags&0x80 != 0 && version < 4 {
+		body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		// skip the extended header
+		extended := int(binary.BigEndian.Uint32(body))
+		if version == 3 {
+			extended += 4 // 2.3 doesn't count the size itself
+		} else {
+			extended = syncsafe(body[:4])
+		}
+		body = body[min(extended, len(body)):]
+	}
+
+	idLength, headerLength := 4, 10
+	index := 1
+	if version == 2 {
+		idLength, headerLength, index = 3, 6, 0
+	}
+
+	coverType := -1
+	for len(body) >= headerLength && body[0] != 0 {
+		id := string(body[:idLength])
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:]))
+			frameFlags = binary.BigEndian.Uint16(body[8:])
+		case 4:
+			frameSize = syncsafe(body[4:8])
+			frameFlags = binary.BigEndian.Uint16(body[8:])
+		}
+		if frameSize < 0 || headerLength+frameSize > len(body) {
+			break
+		}
+		frame := body[headerLength : headerLength+frameSize]
+		body = body[headerLength+frameSize:]
+
+		// compressed or encrypted frames can't be read without more work than they're worth
+		if version == 3 && frameFlags&0x00c0 != 0 || version == 4 && frameFlags&0x000c != 0 {
+			continue
+		}
+		if version == 4 && frameFlags&0x0002 != 0 {
+			frame = bytes.ReplaceAll(frame, []byte{0xff, 0x00}, []byte{0xff})
+		}
+		if version == 4 && frameFlags&0x0001 != 0 && len(frame) >= 4 {
+			frame = frame[4:] // data length indicator
+		}
+
+		switch id {
+		case frameIDs["title"][index]:
+			tags.Title = decodeText(frame)
+		case frameIDs["artist"][index]:
+			tags.Artist = decodeText(frame)
+		case frameIDs["album"][index]:
+			tags.Album = decodeText(frame)
+		case frameIDs["genre"][index]:
+			tags.Genre = genreName(decodeText(frame))
+		case frameIDs["cover"][index]:
+			picture, mime, pictureType, ok := decodePicture(frame, version)
+			// keep the front cover over any other picture
+			if ok && (coverType < 0 || pictureType == frontCover && coverType != frontCover) {
+				tags.Cover, tags.CoverMIME, coverType = picture, mime, pictureType
+			}
+		}
+	}
+	return tags, true
+}
+
+// syncsafe reads an ID3v2 size, which only uses 7 bits of each byte
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// decodeText decodes a text frame, which starts with its encoding
+func decodeText(frame []byte) string {
+	if len(frame) < 1 {
+		return ""
+	}
+	text, _ := decodeString(frame[0], frame[1:])
+	// 2.4 separates multiple values with null characters, only the first one is used
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
+
+// decodeString decodes a null terminated string, returning the bytes after it
+func decodeString(encoding byte, b []byte) (string, []byte) {
+	if encoding == 1 || encoding == 2 {
+		// UTF-16 ends with two null bytes, aligned to a character
+		end := len(b)
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		rest := b[min(end+2, len(b)):]
+		return decodeUTF16(b[:end], encoding == 2), rest
+	}
+
+	end := bytes.IndexByte(b, 0)
+	rest := []byte{}
+	if end < 0 {
+		end = len(b)
+	} else {
+		rest = b[end+1:]
+	}
+	if encoding == 0 {
+		// ISO-8859-1 maps straight to the first 256 code points
+		runes := make([]rune, end)
+		for i, c := range b[:end] {
+			runes[i] = rune(c)
+		}
+		return string(runes), rest
+	}
+	return string(b[:end]), rest
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		bigEndian, b = true, b[2:]
+	} else if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+		bigEndian, b = false, b[2:]
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[i*2:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodePicture reads an APIC (or 2.2 PIC) frame
+func decodePicture(frame []byte, version int) ([]byte, string, int, bool) {
+	if len(frame) < 2 {
+		return nil, "", 0, false
+	}
+	encoding := frame[0]
+	rest := frame[1:]
+
+	var mime string
+	if version == 2 {
+		// a 3 letter image format instead of a MIME type
+		if len(rest) < 3 {
+			return nil, "", 0, false
+		}
+		mime = "image/" + strings.ToLower(string(rest[:3]))
+		if mime == "image/jpg" {
+			mime = "image/jpeg"
+		}
+		rest = rest[3:]
+	} else {
+		mime, rest = decodeString(0, rest)
+	}
+	if len(rest) < 1 {
+		return nil, "", 0, false
+	}
+	pictureType := int(rest[0])
+	_, picture := decodeString(encoding, rest[1:]) // description
+	if len(picture) == 0 {
+		return nil, "", 0, false
+	}
+	return picture, mime, pictureType, true
+}
+
+// genreName resolves ID3v1 genre numbers like "(17)" or "17", which many taggers still write
+func genreName(genre string) string {
+	number := strings.TrimSuffix(strings.TrimPrefix(genre, "("), ")")
+	if n, err := strconv.Atoi(number); err == nil {
+		if n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		return ""
+	}
+	// "(17)Rock" has a refinement after the number
+	if strings.HasPrefix(genre, "(") {
+		if _, refinement, ok := strings.Cut(genre, ")"); ok && refinement != "" {
+			return refinement
+		}
+	}
+	return genre
+}
+
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
@@ -0,0 +1,99 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// tag builds an ID3v2 tag from frames in the given version's layout
+func tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	size := len(body)
+	header := []byte{'I', 'D', '3', version, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body...)
+}
+
+func frame(version byte, id string, data []byte) []byte {
+	var header []byte
+	switch version {
+	case 2:
+		header = append([]byte(id), byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	case 3:
+		header = binary.BigEndian.AppendUint32([]byte(id), uint32(len(data)))
+		header = append(header, 0, 0)
+	case 4:
+		size := len(data)
+		header = append([]byte(id), byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f), 0, 0)
+	}
+	return append(header, data...)
+}
+
+func utf16Text(s string) []byte {
+	b := []byte{1, 0xff, 0xfe}
+	for _, r := range s {
+		b = binary.LittleEndian.AppendUint16(b, uint16(r))
+	}
+	return b
+}
+
+func TestReadID3v2(t *testing.T) {
+	frontCover := append([]byte("\x00image/png\x00\x03cover\x00"), "front"...)
+	backCover := append([]byte("\x00image/jpeg\x00\x04\x00"), "back"...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Tags
+	}{
+		{
+			name: "2.3 with UTF-16 text",
+			data: tag(3,
+				frame(3, "TIT2", utf16Text("夜に駆ける")),
+				frame(3, "TPE1", utf16Text("YOASOBI")),
+				frame(3, "TALB", []byte("\x00THE BOOK")),
+				frame(3, "TCON", []byte("\x00(13)")),
+				frame(3, "APIC", backCover),
+				frame(3, "APIC", frontCover),
+			),
+			want: Tags{Title: "夜に駆ける", Artist: "YOASOBI", Album: "THE BOOK", Genre: "Pop", Cover: []byte("front"), CoverMIME: "image/png"},
+		},
+		{
+			name: "2.4 with UTF-8 text",
+			data: tag(4,
+				frame(4, "TIT2", []byte("\x03Ränder\x00")),
+				frame(4, "TCON", []byte("\x03Drum & Bass\x00Electronic")),
+				frame(4, "APIC", backCover),
+			),
+			want: Tags{Title: "Ränder", Genre: "Drum & Bass", Cover: []byte("back"), CoverMIME: "image/jpeg"},
+		},
+		{
+			name: "2.2",
+			data: tag(2,
+				frame(2, "TT2", []byte("\x00Caf\xe9")),
+				frame(2, "TCO", []byte("\x00(17)Rock")),
+				frame(2, "PIC", append([]byte("\x00JPG\x03\x00"), "pic"...)),
+			),
+			want: Tags{Title: "Café", Genre: "Rock", Cover: []byte("pic"), CoverMIME: "image/jpeg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// padding and audio follow the tag
+			data := append(tt.data, frames(2)...)
+			tags, ok := ReadID3v2(data)
+			if !ok {
+				t.Fatal("ReadID3v2() found no tag")
+			}
+			if tags.Title != tt.want.Title || tags.Artist != tt.want.Artist || tags.Album != tt.want.Album || tags.Genre != tt.want.Genre ||
+				!bytes.Equal(tags.Cover, tt.want.Cover) || tags.CoverMIME != tt.want.CoverMIME {
+				t.Errorf("ReadID3v2() = %+v, want %+v", tags, tt.want)
+			}
+		})
+	}
+
+	if _, ok := ReadID3v2(frames(2)); ok {
+		t.Error("ReadID3v2() found a tag in untagged audio")
+	}
+}
@@ -0,0 +1,302 @@
+// Package audio inspects the audio files bundled with converted maps, without decoding them.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrErrorPage means the data is a web page or API error rather than audio, e.g. from a failed download
+	ErrErrorPage = errors.New("data is an HTML or JSON document, not audio")
+	ErrNotMP3    = errors.New("no MP3 frames found")
+)
+
+// MP3Info describes an MP3 file
+type MP3Info struct {
+	Duration     int // ms
+	Bitrate      int // kbps, averaged over the whole file for VBR
+	SampleRate   int // Hz
+	Channels     int
+	Frames       int
+	VBR          bool
+	FrameSamples int // samples per channel in each frame
+
+	ID3v2Size    int // bytes, 0 without an ID3v2 tag
+	AudioStart   int // offset of the first frame
+	Xing         bool
+	Encoder      string // from the LAME tag, e.g. "LAME3.100"
+	EncoderDelay int    // samples the encoder added at the start, from the LAME tag
+	Padding      int    // samples the encoder added at the end, from the LAME tag
+}
+
+// FrameHeader is a parsed 4 byte MPEG audio frame header
+type FrameHeader struct {
+	Version    int // 1, 2 or 25 for MPEG 2.5
+	Layer      int
+	Bitrate    int // kbps
+	SampleRate int
+	Padding    bool
+	CRC        bool // a 16 bit checksum follows the header
+	Channels   int
+	Length     int // bytes, including the header
+	Samples    int // per channel
+}
+
+var bitrates = map[[2]int][15]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var sampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// ParseFrameHeader parses the frame header at the start of b
+func ParseFrameHeader(b []byte) (FrameHeader, bool) {
+	var h FrameHeader
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, false
+	}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.Version = 25
+	case 2:
+		h.Version = 2
+	case 3:
+		h.Version = 1
+	default:
+		return h, false
+	}
+
+	h.Layer = 4 - int((b[1]>>1)&0x03)
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int((b[2] >> 2) & 0x03)
+	// layer bits of 0 are reserved, bitrate 0 is free format which has no fixed frame length
+	if h.Layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return h, false
+	}
+
+	tableVersion := min(h.Version, 2) // MPEG 2.5 shares MPEG 2's bitrates
+	h.Bitrate = bitrates[[2]int{tableVersion, h.Layer}][bitrateIndex]
+	h.SampleRate = sampleRates[h.Version][sampleRateIndex]
+	h.Padding = b[2]&0x02 != 0
+	h.CRC = b[1]&0x01 == 0
+	h.Channels = 2
+	if b[3]>>6 == 3 {
+		h.Channels = 1
+	}
+
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+	switch {
+	case h.Layer == 1:
+		h.Samples = 384
+		h.Length = (12*h.Bitrate*1000/h.SampleRate + padding) * 4
+	case h.Layer == 3 && h.Version != 1:
+		h.Samples = 576
+		h.Length = 72*h.Bitrate*1000/h.SampleRate + padding
+	default:
+		h.Samples = 1152
+		h.Length = 144*h.Bitrate*1000/h.SampleRate + padding
+	}
+	return h, true
+}
+
+// ScanMP3 validates an MP3 file by walking its frames, reading its duration along the way
+func ScanMP3(data []byte) (MP3Info, error) {
+	info, _, err := scan(data)
+	return info, err
+}
+
+// audioFrame is where a frame starts in an MP3 file
+type audioFrame struct {
+	offset int
+	header FrameHeader
+}
+
+// scan walks the frames of an MP3 file, returning the audio frames without the Xing frame
+func scan(data []byte) (MP3Info, []audioFrame, error) {
+	var info MP3Info
+	var frames []audioFrame
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if len(trimmed) > 0 && (trimmed[0] == '<' || trimmed[0] == '{' || trimmed[0] == '[') {
+		return info, nil, ErrErrorPage
+	}
+
+	pos := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		info.ID3v2Size = 10 + syncsafe(data[6:10])
+		if data[5]&0x10 != 0 {
+			info.ID3v2Size += 10 // footer
+		}
+		pos = min(info.ID3v2Size, len(data))
+	}
+
+	// the first frame has to be followed by another one, so random bytes that look like a header don't count
+	start := -1
+	for i := pos; i+4 <= len(data); i++ {
+		h, ok := ParseFrameHeader(data[i:])
+		if !ok {
+			continue
+		}
+		next := i + h.Length
+		if next == len(data) {
+			start = i
+			break
+		}
+		if next2, ok := ParseFrameHeader(data[min(next, len(data)):]); ok && next2.Layer == h.Layer && next2.Version == h.Version {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return info, nil, ErrNotMP3
+	}
+	info.AudioStart = start
+
+	first, _ := ParseFrameHeader(data[start:])
+	info.SampleRate = first.SampleRate
+	info.Channels = first.Channels
+	info.FrameSamples = first.Samples
+	readXing(data[start:min(start+first.Length, len(data))], first, &info)
+
+	samples := 0
+	audioBytes := 0
+	for pos = start; pos+4 <= len(data); {
+		h, ok := ParseFrameHeader(data[pos:])
+		// stop at trailing tags (ID3v1, APE) or garbage
+		if !ok || h.Version != first.Version || h.Layer != first.Layer {
+			break
+		}
+		if h.Bitrate != first.Bitrate {
+			info.VBR = true
+		}
+		if !info.Xing || pos != start {
+			frames = append(frames, audioFrame{offset: pos, header: h})
+		}
+		info.Frames++
+		samples += h.Samples
+		audioBytes += h.Length
+		pos += h.Length
+	}
+
+	// the Xing frame holds no audio
+	if info.Xing {
+		info.Frames--
+		samples -= first.Samples
+		audioBytes -= first.Length
+	}
+	if info.Frames <= 0 {
+		return info, nil, ErrNotMP3
+	}
+
+	samples -= info.EncoderDelay + info.Padding
+	info.Duration = int(int64(max(samples, 0)) * 1000 / int64(info.SampleRate))
+	if info.Duration > 0 {
+		info.Bitrate = int(int64(audioBytes) * 8 / int64(info.Duration))
+	}
+	return info, frames, nil
+}
+
+// readXing reads the Xing/Info header & LAME tag some encoders put into the first frame
+func readXing(frame []byte, h FrameHeader, info *MP3Info) {
+	// the header follows the side information
+	offset := sideInfoStart(h) + sideInfoSize(h)
+	if len(frame) < offset+8 {
+		return
+	}
+	tag := string(frame[offset : offset+4])
+	if tag != "Xing" && tag != "Info" {
+		return
+	}
+	info.Xing = true
+	info.VBR = tag == "Xing"
+
+	// frames, bytes, TOC & quality fields are each optional
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	lame := offset + 8
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{1, 4}, {2, 4}, {4, 100}, {8, 4}} {
+		if flags&field.flag != 0 {
+			lame += field.size
+		}
+	}
+
+	if len(frame) < lame+24 {
+		return
+	}
+	encoder := string(bytes.TrimRight(frame[lame:lame+9], "\x00 "))
+	if encoder == "" || !isPrintable(encoder) {
+		return
+	}
+	info.Encoder = encoder
+	delay := frame[lame+21:]
+	info.EncoderDelay = int(delay[0])<<4 | int(delay[1])>>4
+	info.Padding = int(delay[1]&0x0f)<<8 | int(delay[2])
+}
+
+// sideInfoStart is where a Layer III frame's side information starts, after the header & checksum
+func sideInfoStart(h FrameHeader) int {
+	if h.CRC {
+		return 6
+	}
+	return 4
+}
+
+// sideInfoSize is the size of a Layer III frame's side information, which depends on the version & channels
+func sideInfoSize(h FrameHeader) int {
+	switch {
+	case h.Version == 1 && h.Channels == 1:
+		return 17
+	case h.Version == 1:
+		return 32
+	case h.Channels == 1:
+		return 9
+	}
+	return 17
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// LeadingSamples is how many samples a decoder outputs at the start that players skip: the Xing frame,
+// which decodes as silence, & the encoder & decoder delay when there's a LAME tag
+func (i MP3Info) LeadingSamples() int {
+	samples := gaplessDelay(i)
+	if i.Xing {
+		samples += i.FrameSamples
+	}
+	return samples
+}
+
+func (i MP3Info) String() string {
+	s := fmt.Sprintf("%d:%02d, %d kbps, %d Hz", i.Duration/60000, i.Duration/1000%60, i.Bitrate, i.SampleRate)
+	if i.VBR {
+		s += ", VBR"
+	}
+	if i.Encoder != "" {
+		s += ", " + i.Encoder
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// 128 kbps, 44100 Hz, stereo MPEG 1 Layer III
+var header = []byte{0xff, 0xfb, 0x90, 0x00}
+
+func frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, header)
+	return bytes.Repeat(frame, n)
+}
+
+func xingFrame(delay int, padding int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, header)
+	copy(frame[36:], "Info")
+	frame[43] = 0x01 // only the frame count
+	lame := frame[48:]
+	copy(lame, "LAME3.100")
+	lame[21] = byte(delay >> 4)
+	lame[22] = byte(delay<<4) | byte(padding>>8)
+	lame[23] = byte(padding)
+	return frame
+}
+
+func id3v2(size int) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, make([]byte, size)...)
+}
+
+func TestScanMP3(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    MP3Info
+		wantErr error
+	}{
+		{
+			name: "plain frames",
+			data: frames(100),
+			want: MP3Info{Duration: 2612, Bitrate: 127, SampleRate: 44100, Channels: 2, Frames: 100, FrameSamples: 1152},
+		},
+		{
+			name: "ID3v2 & ID3v1 tags",
+			data: append(append(id3v2(300), frames(100)...), append([]byte("TAG"), make([]byte, 125)...)...),
+			want: MP3Info{Duration: 2612, Bitrate: 127, SampleRate: 44100, Channels: 2, Frames: 100, FrameSamples: 1152, ID3v2Size: 310, AudioStart: 310},
+		},
+		{
+			name: "LAME tag",
+			data: append(xingFrame(576, 1000), frames(100)...),
+			want: MP3Info{Duration: 2576, Bitrate: 129, SampleRate: 44100, Channels: 2, Frames: 100, FrameSamples: 1152, Xing: true, Encoder: "LAME3.100", EncoderDelay: 576, Padding: 1000},
+		},
+		{
+			name:    "HTML error page",
+			data:    []byte("<!DOCTYPE html><html><body>404 Not Found</body></html>"),
+			wantErr: ErrErrorPage,
+		},
+		{
+			name:    "JSON error",
+			data:    []byte(`  {"error": "track not found"}`),
+			wantErr: ErrErrorPage,
+		},
+		{
+			name:    "OGG",
+			data:    append([]byte("OggS"), make([]byte, 1000)...),
+			wantErr: ErrNotMP3,
+		},
+		{
+			name:    "lone sync bytes",
+			data:    append([]byte{0, 0, 0xff, 0xfb, 0x90, 0x00}, make([]byte, 1000)...),
+			wantErr: ErrNotMP3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ScanMP3(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ScanMP3() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && info != tt.want {
+				t.Errorf("ScanMP3() = %#v, want %#v", info, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   FrameHeader
+		ok     bool
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x00}, FrameHeader{Version: 1, Layer: 3, Bitrate: 128, SampleRate: 44100, Channels: 2, Length: 417, Samples: 1152}, true},
+		{[]byte{0xff, 0xfb, 0x92, 0xc0}, FrameHeader{Version: 1, Layer: 3, Bitrate: 128, SampleRate: 44100, Padding: true, Channels: 1, Length: 418, Samples: 1152}, true},
+		{[]byte{0xff, 0xf3, 0x84, 0x00}, FrameHeader{Version: 2, Layer: 3, Bitrate: 64, SampleRate: 24000, Channels: 2, Length: 192, Samples: 576}, true},
+		{[]byte{0xff, 0xfb, 0x00, 0x00}, FrameHeader{}, false}, // free format
+		{[]byte{0xff, 0xfb, 0x9c, 0x00}, FrameHeader{}, false}, // reserved sample rate
+		{[]byte{0xff, 0xe9, 0x90, 0x00}, FrameHeader{}, false}, // reserved layer
+	}
+
+	for _, tt := range tests {
+		h, ok := ParseFrameHeader(tt.header)
+		if ok != tt.ok || (ok && h != tt.want) {
+			t.Errorf("ParseFrameHeader(% x) = %+v, %v, want %+v, %v", tt.header, h, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package clicktrack mixes clicks into a song at a chart's note or beat times, so its timing can be
+// checked by ear without opening osu!.
+package clicktrack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/audio"
+	"github.com/cxntered/SpareChange/pkg/types"
+	"github.com/hajimehoshi/go-mp3"
+)
+
+const (
+	clickLength   = 30     // ms
+	clickPitch    = 1000.0 // Hz
+	accentPitch   = 1500.0 // Hz, for the first beat of a measure
+	clickVolume   = 0.6
+	musicVolume   = 0.7 // the music is turned down a little so the clicks stand out
+	maxBeats      = 100000
+	bytesPerFrame = 4 // go-mp3 always decodes to 16 bit stereo
+)
+
+// Click is a point in time to click at, in ms
+type Click struct {
+	Time   int
+	Accent bool
+}
+
+// NoteClicks clicks once at every time a note starts
+func NoteClicks(diff types.OsuFile) []Click {
+	seen := make(map[int]bool)
+	var clicks []Click
+	for _, hitObject := range diff.HitObjects.List {
+		if !seen[hitObject.Time] {
+			seen[hitObject.Time] = true
+			clicks = append(clicks, Click{Time: hitObject.Time})
+		}
+	}
+	sort.Slice(clicks, func(i, j int) bool {
+		return clicks[i].Time < clicks[j].Time
+	})
+	return clicks
+}
+
+// BeatClicks clicks at every beat of the uninherited timing points up to end, accenting the start of each measure
+func BeatClicks(diff types.OsuFile, end int) []Click {
+	var redLines []types.TimingPoint
+	for _, timingPoint := range diff.TimingPoints.List {
+		if timingPoint.Uninherited && timingPoint.BeatLength > 0 {
+			redLines = append(redLines, timingPoint)
+		}
+	}
+	sort.SliceStable(redLines, func(i, j int) bool {
+		return redLines[i].Time < redLines[j].Time
+	})
+
+	var clicks []Click
+	for i, redLine := range redLines {
+		until := float64(end)
+		if i+1 < len(redLines) {
+			until = float64(redLines[i+1].Time)
+		}
+		meter := int(max(redLine.Meter, 1))
+		for beat := 0; len(clicks) < maxBeats; beat++ {
+			time := float64(redLine.Time) + float64(beat)*redLine.BeatLength
+			if time >= until {
+				break
+			}
+			clicks = append(clicks, Click{Time: int(math.Round(time)), Accent: beat%meter == 0})
+		}
+	}
+	return clicks
+}
+
+// Render decodes an MP3, mixes in the clicks & writes the result as a 16 bit stereo WAV file. The samples players
+// skip at the start are left out, so the clicks line up with what osu! plays.
+func Render(w io.Writer, mp3Data []byte, clicks []Click) error {
+	info, err := audio.ScanMP3(mp3Data)
+	if err != nil {
+		return err
+	}
+	decoder, err := mp3.NewDecoder(bytes.NewReader(mp3Data))
+	if err != nil {
+		return err
+	}
+	pcm, err := io.ReadAll(decoder)
+	if err != nil {
+		return err
+	}
+	pcm = pcm[min(info.LeadingSamples()*bytesPerFrame, len(pcm)):]
+	if len(pcm) == 0 {
+		return errors.New("MP3 has no audio")
+	}
+	rate := decoder.SampleRate()
+
+	// mixed in place, as a whole song is already tens of megabytes of PCM
+	for i := 0; i+2 <= len(pcm); i += 2 {
+		putSample(pcm[i:], float64(int16(binary.LittleEndian.Uint16(pcm[i:])))*musicVolume)
+	}
+	frames := len(pcm) / bytesPerFrame
+
+	sounds := map[bool][]float64{false: click(rate, clickPitch), true: click(rate, accentPitch)}
+	for _, c := range clicks {
+		start := int(math.Round(float64(c.Time) * float64(rate) / 1000))
+		for i, value := range sounds[c.Accent] {
+			frame := start + i
+			if frame < 0 || frame >= frames {
+				continue
+			}
+			for channel := range 2 {
+				sample := pcm[frame*bytesPerFrame+channel*2:]
+				putSample(sample, float64(int16(binary.LittleEndian.Uint16(sample)))+value)
+			}
+		}
+	}
+	return writeWAV(w, pcm[:frames*bytesPerFrame], rate)
+}
+
+// putSample writes a 16 bit sample, clipping it to the range it can hold
+func putSample(b []byte, sample float64) {
+	binary.LittleEndian.PutUint16(b, uint16(int16(max(min(sample, math.MaxInt16), math.MinInt16))))
+}
+
+// click is a short sine wave that fades out
+func click(rate int, pitch float64) []float64 {
+	length := rate * clickLength / 1000
+	sound := make([]float64, length)
+	for i := range sound {
+		t := float64(i) / float64(rate)
+		fade := math.Exp(-5 * float64(i) / float64(length))
+		sound[i] = math.Sin(2*math.Pi*pitch*t) * fade * clickVolume * math.MaxInt16
+	}
+	return sound
+}
+
+// writeWAV writes 16 bit stereo PCM with a canonical 44 byte header
+func writeWAV(w io.Writer, pcm []byte, rate int) error {
+	header := make([]byte, 44)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(pcm)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 2)
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate*bytesPerFrame))
+	binary.LittleEndian.PutUint16(header[32:], bytesPerFrame)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(pcm)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(pcm)
+	return err
+}
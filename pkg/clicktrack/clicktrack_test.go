@@ -0,0 +1,106 @@
+package clicktrack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/audio"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// silence decodes to n frames of 128 kbps, 44100 Hz stereo silence
+func silence(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+// lameTag is an Info frame with a LAME tag saying the encoder added delay samples at the start
+func lameTag(delay int) []byte {
+	frame := silence(1)
+	copy(frame[36:], "Info")
+	frame[43] = 0x01 // only the frame count
+	lame := frame[48:]
+	copy(lame, "LAME3.100")
+	lame[21] = byte(delay >> 4)
+	lame[22] = byte(delay << 4)
+	return frame
+}
+
+func TestNoteClicks(t *testing.T) {
+	var diff types.OsuFile
+	for _, time := range []int{500, 0, 500, 250} {
+		diff.HitObjects.List = append(diff.HitObjects.List, types.HitObject{Time: time})
+	}
+	want := []Click{{Time: 0}, {Time: 250}, {Time: 500}}
+	if got := NoteClicks(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("NoteClicks() = %v, want %v", got, want)
+	}
+}
+
+func TestBeatClicks(t *testing.T) {
+	var diff types.OsuFile
+	diff.TimingPoints.List = []types.TimingPoint{
+		{Time: 1000, BeatLength: 250, Meter: 3, Uninherited: true},
+		{Time: 100, BeatLength: 400, Meter: 4, Uninherited: true},
+		{Time: 500, BeatLength: -50},
+	}
+	want := []Click{
+		{Time: 100, Accent: true}, {Time: 500}, {Time: 900},
+		{Time: 1000, Accent: true}, {Time: 1250}, {Time: 1500}, {Time: 1750, Accent: true},
+	}
+	if got := BeatClicks(diff, 2000); !reflect.DeepEqual(got, want) {
+		t.Errorf("BeatClicks() = %v, want %v", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int // frames of audio in the output
+	}{
+		{name: "no LAME tag", data: silence(40), frames: 40 * 1152},
+		// the Info frame & 576 + 529 samples of delay are skipped
+		{name: "LAME tag", data: append(lameTag(576), silence(40)...), frames: 40*1152 - 576 - 529},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Render(&buf, tt.data, []Click{{Time: 500}, {Time: 60000}}); err != nil {
+				t.Fatalf("Render() error: %v", err)
+			}
+
+			info, err := audio.Probe(buf.Bytes())
+			if err != nil || info.Format != audio.FormatWAV || info.SampleRate != 44100 || info.Channels != 2 {
+				t.Fatalf("Probe(output) = %+v, %v, want a 44100 Hz stereo WAV", info, err)
+			}
+
+			// the output is silent except for the click
+			pcm := buf.Bytes()[44:]
+			if len(pcm) != tt.frames*4 {
+				t.Errorf("output has %d frames, want %d", len(pcm)/4, tt.frames)
+			}
+			first, last := -1, -1
+			for i := 0; i+4 <= len(pcm); i += 4 {
+				if binary.LittleEndian.Uint16(pcm[i:]) != 0 {
+					if first < 0 {
+						first = i / 4
+					}
+					last = i / 4
+				}
+			}
+			if start := 500 * 44100 / 1000; first < start || first > start+1 || last > start+clickLength*44100/1000 {
+				t.Errorf("click between frames %d & %d, want it from %d for %dms", first, last, start, clickLength)
+			}
+		})
+	}
+
+	if err := Render(io.Discard, make([]byte, 100), nil); err == nil {
+		t.Error("Render(not an MP3) succeeded, want an error")
+	}
+}
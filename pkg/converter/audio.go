@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/audio"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// CheckAudio works out the format of the audio bundled with a map & warns about notes after it ends,
+// or when osu! can't play it. Data that isn't audio at all, like an error page from a failed download, is an error.
+func CheckAudio(osuMap types.OsuMap, data []byte) (audio.Info, []Warning, error) {
+	info, err := audio.Probe(data)
+	if errors.Is(err, audio.ErrErrorPage) {
+		return info, nil, err
+	}
+	if err != nil {
+		// could still be audio osu! can play, so only warn
+		return info, []Warning{{
+			Kind:    WarningNotMP3,
+			Section: -1,
+			Row:     -1,
+			Count:   1,
+			Message: fmt.Sprintf("audio file couldn't be read (%v), osu! may not be able to play it", err),
+		}}, nil
+	}
+
+	var warnings []Warning
+	// there's no pure Go encoder for MP3 or Vorbis, so other formats are bundled as they are
+	if !info.Format.Playable() || info.Codec == "opus" {
+		name := strings.ToUpper(string(info.Format))
+		if info.Codec == "opus" {
+			name = "Opus"
+		}
+		warnings = append(warnings, Warning{
+			Kind:    WarningUnplayableAudio,
+			Section: -1,
+			Row:     -1,
+			Count:   1,
+			Message: fmt.Sprintf("osu! only plays MP3 & OGG Vorbis audio, convert the %s file before uploading the map", name),
+		})
+	}
+	if info.Duration <= 0 {
+		return info, warnings, nil
+	}
+
+	for _, diff := range osuMap.Difficulties {
+		warning := Warning{Kind: WarningAfterAudioEnd, Level: diff.Metadata.Version, Section: -1, Row: -1}
+		for _, hitObject := range diff.HitObjects.List {
+			if max(hitObject.Time, hitObject.ObjectParams.EndTime) <= info.Duration {
+				continue
+			}
+			if warning.Count == 0 || hitObject.Time < warning.Time {
+				warning.Time = hitObject.Time
+				if hitObject.Source != nil {
+					warning.Section, warning.Row = hitObject.Source.Section, hitObject.Source.Row
+				}
+			}
+			warning.Count++
+		}
+		if warning.Count > 0 {
+			warning.Message = fmt.Sprintf("notes from %dms on are after the audio ends at %dms", warning.Time, info.Duration)
+			warnings = append(warnings, warning)
+		}
+	}
+	return info, warnings, nil
+}
+
+// SetAudioFilename names the audio after its format, returning the name it goes into the .osz under.
+// Audio of an unknown format keeps the .mp3 extension, as that's what Sparebeat serves.
+func SetAudioFilename(osuMap *types.OsuMap, format audio.Format) string {
+	if format == "" {
+		format = audio.FormatMP3
+	}
+	name := "audio" + format.Extension()
+	osuMap.General.AudioFilename = name
+	for i := range osuMap.Difficulties {
+		osuMap.Difficulties[i].General.AudioFilename = name
+	}
+	return name
+}
+
+// ApplyAudioTags fills in metadata from the audio's ID3 tags, which are usually more accurate than Sparebeat's
+func ApplyAudioTags(osuMap *types.OsuMap, tags audio.Tags) {
+	apply := func(metadata *types.MetadataSection) {
+		if tags.Title != "" {
+			metadata.TitleUnicode = tags.Title
+		}
+		if tags.Artist != "" {
+			metadata.ArtistUnicode = tags.Artist
+		}
+		if tags.Album != "" {
+			metadata.Source = tags.Album
+		}
+		genre := strings.ToLower(strings.Join(strings.Fields(tags.Genre), "_"))
+		if genre != "" && !slices.Contains(metadata.Tags, genre) {
+			metadata.Tags = append(slices.Clone(metadata.Tags), genre)
+		}
+	}
+
+	apply(&osuMap.Metadata)
+	for i := range osuMap.Difficulties {
+		apply(&osuMap.Difficulties[i].Metadata)
+	}
+}
+
+// AlignAudio pads the audio with silent frames when notes would start before it, or with trimSilence cuts
+// its leading silence, moving the chart to match. It returns the new audio & how far the chart moved.
+// The audio is left as it is when it can't be changed, e.g. when it isn't an MP3.
+func AlignAudio(osuMap *types.OsuMap, data []byte, trimSilence bool) ([]byte, int, error) {
+	earliest := math.MaxInt
+	for _, diff := range osuMap.Difficulties {
+		for _, hitObject := range diff.HitObjects.List {
+			earliest = min(earliest, hitObject.Time)
+		}
+	}
+	if earliest == math.MaxInt || earliest >= 0 && !trimSilence {
+		return data, 0, nil
+	}
+	if info, err := audio.Probe(data); err == nil && info.Format != audio.FormatMP3 {
+		return data, 0, fmt.Errorf("only MP3 audio can be padded or trimmed, not %s", strings.ToUpper(string(info.Format)))
+	}
+
+	aligned, shift := data, 0
+	var err error
+	switch {
+	case earliest < 0:
+		aligned, shift, err = audio.PadMP3(data, -earliest)
+	case trimSilence:
+		// stop cutting where the first note is, so no notes end up before the audio
+		aligned, shift, err = audio.TrimMP3(data, earliest)
+		shift = -shift
+	}
+	if err != nil {
+		return data, 0, err
+	}
+
+	Shift(osuMap, shift)
+	return aligned, shift, nil
+}
@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+const (
+	defaultBreakThreshold = 5000 // ms
+	breakLeadOut          = 200  // ms after the last note before a break may start
+	breakLeadIn           = 1000 // ms before the next note a break has to end, so it scrolls in
+	minBreakLength        = 650  // ms, osu! ignores shorter breaks
+)
+
+// breaks finds gaps between notes longer than the threshold & turns them into break periods,
+// which osu! doesn't drain HP during
+func breaks(hitObjects []types.HitObject, threshold int) []types.Event {
+	objects := append([]types.HitObject(nil), hitObjects...)
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Time < objects[j].Time
+	})
+
+	var events []types.Event
+	end := 0 // when every object so far has ended, as holds can end after later notes
+	for i, object := range objects {
+		gap := object.Time - end
+		start, stop := end+breakLeadOut, object.Time-breakLeadIn
+		end = max(end, object.Time, object.ObjectParams.EndTime)
+		if i == 0 || gap < threshold || stop-start < minBreakLength {
+			continue
+		}
+
+		events = append(events, types.Event{
+			EventType: types.EventTypeBreak,
+			StartTime: start,
+			EventParams: types.EventParams{
+				EndTime: stop,
+			},
+		})
+	}
+	return events
+}
@@ -2,20 +2,39 @@ package converter
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
 
+	"github.com/cxntered/SpareChange/pkg/analysis"
 	"github.com/cxntered/SpareChange/pkg/types"
 )
 
-func ConvertSparebeatToOsu(sbMap types.SparebeatMap) (types.OsuMap, error) {
+func ConvertSparebeatToOsu(sbMap types.SparebeatMap) (Result, error) {
+	return ConvertSparebeatToOsuWithOptions(sbMap, Options{})
+}
+
+func ConvertSparebeatToOsuWithOptions(sbMap types.SparebeatMap, opts Options) (Result, error) {
+	result := Result{BindZones: make(map[string][]BindZone)}
 	var osuMap types.OsuMap
 
+	if bpm := getBPM(sbMap.BPM); !isValidNumber(bpm) {
+		return result, fmt.Errorf("invalid BPM %v", sbMap.BPM)
+	}
+	// everything is timed from the start time, so moving it moves the whole chart
+	sbMap.StartTime += opts.Offset
+
 	osuMap.General = types.GeneralSection{
 		AudioFilename: "audio.mp3",
 		Mode:          types.ModeMania,
 	}
+	if opts.Storyboard {
+		osuMap.General.WidescreenStoryboard = true
+	}
 
 	osuMap.Metadata = types.MetadataSection{
 		Title:         sbMap.Title,
@@ -24,6 +43,7 @@ func ConvertSparebeatToOsu(sbMap types.SparebeatMap) (types.OsuMap, error) {
 		ArtistUnicode: sbMap.Artist,
 		Creator:       "Sparebeat",
 		Source:        sbMap.URL,
+		BeatmapSetID:  opts.IDs.SetID,
 	}
 
 	// TODO: placeholder values, probably change later
@@ -49,33 +69,240 @@ func ConvertSparebeatToOsu(sbMap types.SparebeatMap) (types.OsuMap, error) {
 	}
 
 	if isLevelEnabled(sbMap.Level.Easy) {
-		easy, err := convertSparebeatDifficulty(sbMap, osuMap, "Easy")
+		easy, err := convertLevel(sbMap, osuMap, "Easy", opts, &result)
 		if err != nil {
-			return osuMap, err
+			return result, err
 		}
 		osuMap.Difficulties = append(osuMap.Difficulties, easy)
 	}
 
 	if isLevelEnabled(sbMap.Level.Normal) {
-		normal, err := convertSparebeatDifficulty(sbMap, osuMap, "Normal")
+		normal, err := convertLevel(sbMap, osuMap, "Normal", opts, &result)
 		if err != nil {
-			return osuMap, err
+			return result, err
 		}
 		osuMap.Difficulties = append(osuMap.Difficulties, normal)
 	}
 
 	if isLevelEnabled(sbMap.Level.Hard) {
-		hard, err := convertSparebeatDifficulty(sbMap, osuMap, "Hard")
+		hard, err := convertLevel(sbMap, osuMap, "Hard", opts, &result)
 		if err != nil {
-			return osuMap, err
+			return result, err
 		}
 		osuMap.Difficulties = append(osuMap.Difficulties, hard)
 	}
 
-	return osuMap, nil
+	// tags & the preview point are shared by every difficulty so the set is consistent
+	osuMap.Metadata.Tags = tags(sbMap, osuMap, opts)
+	osuMap.General.PreviewTime = previewTime(Result{Map: osuMap, BindZones: result.BindZones}, opts)
+	for i := range osuMap.Difficulties {
+		osuMap.Difficulties[i].General.PreviewTime = osuMap.General.PreviewTime
+		osuMap.Difficulties[i].Metadata.Tags = osuMap.Metadata.Tags
+		osuMap.Difficulties[i].Metadata.BeatmapID = opts.IDs.Difficulties[osuMap.Difficulties[i].Metadata.Version]
+	}
+
+	if opts.bindZones() == BindZoneStoryboard {
+		for _, diff := range osuMap.Difficulties {
+			if len(result.BindZones[diff.Metadata.Version]) > 0 {
+				osuMap.Files = map[string][]byte{PixelFileName: PixelImage()}
+				break
+			}
+		}
+	}
+
+	if opts.Storyboard {
+		storyboard, files, warnings := GenerateStoryboard(sbMap, EndTime(osuMap))
+		osuMap.Storyboard = storyboard
+		if osuMap.Files == nil {
+			osuMap.Files = make(map[string][]byte)
+		}
+		for name, content := range files {
+			osuMap.Files[name] = content
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	result.Map = osuMap
+	return result, nil
+}
+
+// tags describes where a map came from & what it plays like, e.g. "sparebeat stable <id> hard-11 jumpstream"
+func tags(sbMap types.SparebeatMap, osuMap types.OsuMap, opts Options) []string {
+	list := []string{"sparebeat", "stable"}
+	if opts.Beta {
+		list[1] = "beta"
+	}
+	if sbMap.ID != "" {
+		list = append(list, sbMap.ID)
+	}
+
+	for _, diff := range osuMap.Difficulties {
+		level := sbMap.Level.Easy
+		switch diff.Metadata.Version {
+		case "Normal":
+			level = sbMap.Level.Normal
+		case "Hard":
+			level = sbMap.Level.Hard
+		}
+		list = append(list, fmt.Sprintf("%s-%v", strings.ToLower(diff.Metadata.Version), level))
+	}
+
+	seen := make(map[analysis.Pattern]bool)
+	for _, diff := range osuMap.Difficulties {
+		for _, pattern := range analysis.Analyze(diff).Dominant {
+			if !seen[pattern] {
+				seen[pattern] = true
+				list = append(list, string(pattern))
+			}
+		}
+	}
+
+	// tags are separated by spaces, so they can't contain any
+	for i, tag := range list {
+		list[i] = strings.Join(strings.Fields(tag), "_")
+	}
+	return list
+}
+
+// EndTime returns when the last object of any difficulty ends
+func EndTime(osuMap types.OsuMap) int {
+	end := 0
+	for _, diff := range osuMap.Difficulties {
+		for _, hitObject := range diff.HitObjects.List {
+			end = max(end, hitObject.Time, hitObject.ObjectParams.EndTime)
+		}
+	}
+	return end
+}
+
+// parseState carries everything that persists between the sections of a single difficulty
+type parseState struct {
+	level       string
+	section     int // index into the level's map data
+	startTime   int
+	elapsedTime float64
+	bpm         float64
+	baseBPM     float64
+	rowsPerBeat uint               // 4 rows per beat normally, 6 in 24th mode
+	meter       uint               // beats per measure, from the map's beats field
+	barMeter    uint               // meter of the current red line, which differs from meter for sections of another length
+	offGrid     bool               // the last section wasn't a whole number of beats long, so the bar lines need to be restarted
+	holdNotes   map[uint]holdStart // column index -> hold start
+	laneFreeAt  map[uint]int       // column index -> time the column's last object ends
+	in24thMode  bool
+	inBindZone  bool
+	bindZones   []BindZone
+	bindZone    BindZoneMode
+	sv          float64 // beat length of the current inherited timing point
+	speed       float64 // Sparebeat's scroll speed multiplier
+	stopped     bool    // a BPM of 0 stopped the chart
+	scroll      ScrollMode
+	warnings    []Warning
+}
+
+type holdStart struct {
+	time    int
+	section int
+	row     int
+	source  *types.SourcePos
+}
+
+// currentTime is the time of the row the next section would start on
+func (s *parseState) currentTime() int {
+	return s.startTime + int(s.elapsedTime) - int(60*1000/s.bpm/4)
+}
+
+func (s *parseState) source(row int, column int, char string) *types.SourcePos {
+	return &types.SourcePos{
+		Level:   s.level,
+		Section: s.section,
+		Row:     row,
+		Column:  column,
+		Char:    char,
+	}
+}
+
+func newParseState(level string, startTime int, bpm float64, beats uint) *parseState {
+	state := &parseState{
+		level:       level,
+		startTime:   startTime,
+		bpm:         bpm,
+		baseBPM:     bpm,
+		rowsPerBeat: 4,
+		meter:       4,
+		holdNotes:   make(map[uint]holdStart),
+		laneFreeAt:  make(map[uint]int),
+		bindZone:    BindZoneKiai,
+		sv:          -100,
+		speed:       1,
+		scroll:      ScrollFaithful,
+	}
+	if beats != 0 {
+		state.meter = beats
+	}
+	state.barMeter = state.meter
+	return state
+}
+
+// svChange moves the scroll speed to the current one, returning the inherited timing point to do it if needed
+func (s *parseState) svChange(time int) []types.TimingPoint {
+	sv := s.currentSV()
+	if sv == s.sv {
+		return []types.TimingPoint{}
+	}
+	s.sv = sv
+	return []types.TimingPoint{{
+		Time:        time,
+		BeatLength:  sv,
+		Meter:       s.meter,
+		SampleSet:   0,
+		SampleIndex: 0,
+		Volume:      100,
+		Uninherited: false,
+		Effects:     types.EffectNone,
+		Source:      s.source(-1, -1, ""),
+	}}
 }
 
-func convertSparebeatDifficulty(sbMap types.SparebeatMap, osuMap types.OsuMap, levelName string) (types.OsuFile, error) {
+// currentSV is the beat length of the inherited timing point that gives the current scroll speed
+func (s *parseState) currentSV() float64 {
+	switch {
+	case s.scroll == ScrollConstant:
+		return -100
+	case s.stopped:
+		return svBeatLength(0)
+	case s.scroll == ScrollNative:
+		return svBeatLength(s.speed)
+	}
+	// osu! scrolls faster at higher BPMs while Sparebeat doesn't, so that's cancelled out
+	return svBeatLength(s.speed * s.baseBPM / s.bpm)
+}
+
+func (s *parseState) warn(kind WarningKind, row int, time int, message string) {
+	s.warnings = append(s.warnings, Warning{
+		Kind:    kind,
+		Level:   s.level,
+		Section: s.section,
+		Row:     row,
+		Time:    time,
+		Count:   1,
+		Message: message,
+	})
+}
+
+// convertLevel converts a difficulty twice: scroll speeds are normalized against the BPM it spends the most
+// time in, which takes a first pass to find
+func convertLevel(sbMap types.SparebeatMap, osuMap types.OsuMap, levelName string, opts Options, result *Result) (types.OsuFile, error) {
+	scratch := Result{BindZones: make(map[string][]BindZone)}
+	osuFile, err := convertSparebeatDifficulty(sbMap, osuMap, levelName, opts, 0, &scratch)
+	if err != nil {
+		return osuFile, err
+	}
+	return convertSparebeatDifficulty(sbMap, osuMap, levelName, opts, DominantBPM(osuFile), result)
+}
+
+// convertSparebeatDifficulty converts one level, with SV relative to baseBPM, or to the first BPM when it's 0
+func convertSparebeatDifficulty(sbMap types.SparebeatMap, osuMap types.OsuMap, levelName string, opts Options, baseBPM float64, result *Result) (types.OsuFile, error) {
 	var osuFile types.OsuFile
 
 	osuFile.Version = 14
@@ -83,7 +310,7 @@ func convertSparebeatDifficulty(sbMap types.SparebeatMap, osuMap types.OsuMap, l
 	osuFile.Metadata = osuMap.Metadata
 	osuFile.Metadata.Version = levelName
 	osuFile.Difficulty = osuMap.Difficulty
-	osuFile.Events = osuMap.Events
+	osuFile.Events.List = append([]types.Event(nil), osuMap.Events.List...)
 
 	var mapData []interface{}
 	switch levelName {
@@ -97,86 +324,217 @@ func convertSparebeatDifficulty(sbMap types.SparebeatMap, osuMap types.OsuMap, l
 		mapData = sbMap.Map.Hard
 	}
 
-	var elapsedTime float64 = 0
-	bpm := getBPM(sbMap.BPM)
-	baseBPM := bpm
-	var beats uint = 4
-	if sbMap.Beats != 0 {
-		beats = sbMap.Beats
+	state := newParseState(levelName, sbMap.StartTime, getBPM(sbMap.BPM), sbMap.Beats)
+	state.bindZone = opts.bindZones()
+	state.scroll = opts.scroll()
+	if baseBPM > 0 {
+		state.baseBPM = baseBPM
 	}
-	prevBeats := beats
-	holdNotes := make(map[uint]int) // column index -> start time
-	in24thMode := false
-	inBindZone := false
+	state.sv = state.currentSV()
+	firstSV := state.sv
+	// the first red line starts the first measure, on the first row
+	osuFile.TimingPoints.List = []types.TimingPoint{{
+		Time:        state.currentTime(),
+		BeatLength:  60 * 1000 / state.bpm,
+		Meter:       state.meter,
+		SampleSet:   0,
+		SampleIndex: 0,
+		Volume:      100,
+		Uninherited: true,
+		Effects:     types.EffectNone,
+	}}
+
+	// every section is a measure, so the last one doesn't need its length marked
+	lastSection := -1
+	for i, elem := range mapData {
+		if _, ok := elem.(string); ok {
+			lastSection = i
+		}
+	}
+
+	for i, elem := range mapData {
+		state.section = i
 
-	for _, elem := range mapData {
 		switch v := elem.(type) {
 		case string:
-			hitObjects, timingPoints := parseSections(v, sbMap.StartTime, &elapsedTime, bpm, &beats, prevBeats, holdNotes, &in24thMode, &inBindZone)
+			start, elapsed, kiai := state.currentTime(), state.elapsedTime, state.inBindZone && state.bindZone == BindZoneKiai
+			hitObjects, timingPoints := parseSections(v, state)
 			osuFile.HitObjects.List = append(osuFile.HitObjects.List, hitObjects...)
 			osuFile.TimingPoints.List = append(osuFile.TimingPoints.List, timingPoints...)
+			if i != lastSection {
+				beats := (state.elapsedTime - elapsed) * state.bpm / 60 / 1000
+				osuFile.TimingPoints.List = state.markMeasure(osuFile.TimingPoints.List, start, beats, kiai)
+			}
 
 		case map[string]interface{}:
-			timingPoints := parseMapOptions(v, sbMap.StartTime, elapsedTime, &bpm, beats, baseBPM)
-			for _, timingPoint := range timingPoints {
-				if timingPoint.Time < sbMap.StartTime && len(osuFile.TimingPoints.List) == 0 {
-					osuFile.TimingPoints.List = append(osuFile.TimingPoints.List, types.TimingPoint{
-						Time:        0,
-						BeatLength:  60 * 1000 / bpm,
-						Meter:       beats,
-						SampleSet:   0,
-						SampleIndex: 0,
-						Volume:      100,
-						Uninherited: true,
-						Effects:     types.EffectOmitFirstBarLine,
+			for _, timingPoint := range parseMapOptions(v, state) {
+				// a BPM change replaces a red line at the same time, e.g. the first one
+				if timingPoint.Uninherited {
+					osuFile.TimingPoints.List = slices.DeleteFunc(osuFile.TimingPoints.List, func(existing types.TimingPoint) bool {
+						return existing.Uninherited && existing.Time == timingPoint.Time
 					})
 				}
 				osuFile.TimingPoints.List = append(osuFile.TimingPoints.List, timingPoint)
 			}
+
+		default:
+			state.warn(WarningIgnoredOption, -1, state.startTime+int(state.elapsedTime), fmt.Sprintf("unsupported map data %v ignored", elem))
+		}
+	}
+
+	// bind zones without a closing bracket persist until the end of the map
+	if state.inBindZone {
+		state.bindZones[len(state.bindZones)-1].End = state.currentTime()
+	}
+
+	if threshold := opts.breakThreshold(); threshold > 0 {
+		osuFile.Events.List = append(osuFile.Events.List, breaks(osuFile.HitObjects.List, threshold)...)
+	}
+
+	switch state.bindZone {
+	case BindZoneStoryboard:
+		osuFile.Events.List = append(osuFile.Events.List, bindZoneSprites(state.bindZones)...)
+	case BindZoneBookmarks:
+		for _, zone := range state.bindZones {
+			osuFile.Editor.Bookmarks = append(osuFile.Editor.Bookmarks, zone.Start, zone.End)
 		}
 	}
+	if len(state.bindZones) > 0 {
+		result.BindZones[levelName] = state.bindZones
+	}
 
-	osuFile.TimingPoints.List = append(osuFile.TimingPoints.List, types.TimingPoint{
-		Time:        sbMap.StartTime,
-		BeatLength:  60 * 1000 / bpm,
-		Meter:       beats,
+	// holds that were started but never ended are dropped
+	lanes := make([]uint, 0, len(state.holdNotes))
+	for lane := range state.holdNotes {
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool { return lanes[i] < lanes[j] })
+	for _, lane := range lanes {
+		hold := state.holdNotes[lane]
+		state.section = hold.section
+		state.warn(WarningDroppedHold, hold.row, hold.time, fmt.Sprintf("hold note in column %d is never ended, dropped", lane))
+	}
+
+	// the first BPM needs SV too when it isn't the dominant one
+	if firstSV != -100 {
+		first := osuFile.TimingPoints.List[0]
+		osuFile.TimingPoints.List = append(osuFile.TimingPoints.List, types.TimingPoint{
+			Time:        first.Time,
+			BeatLength:  firstSV,
+			Meter:       first.Meter,
+			SampleSet:   0,
+			SampleIndex: 0,
+			Volume:      100,
+			Uninherited: false,
+			Effects:     types.EffectNone,
+		})
+	}
+	// red lines go first at the same time, as they reset what the green ones set
+	sort.SliceStable(osuFile.TimingPoints.List, func(i, j int) bool {
+		a, b := osuFile.TimingPoints.List[i], osuFile.TimingPoints.List[j]
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.Uninherited && !b.Uninherited
+	})
+
+	result.Warnings = append(result.Warnings, state.warnings...)
+	return osuFile, nil
+}
+
+// markMeasure restarts the bar lines with a red line where a section of a different length than the meter starts,
+// & again after it, as osu! draws bar lines every meter beats from the last red line while Sparebeat draws
+// one at the start of every section. kiai is whether the section starts in a kiai bind zone.
+func (s *parseState) markMeasure(timingPoints []types.TimingPoint, start int, beats float64, kiai bool) []types.TimingPoint {
+	whole := math.Abs(beats-math.Round(beats)) < 1e-6
+	meter := s.meter
+	if !whole || math.Round(beats) != float64(s.meter) {
+		meter = uint(max(math.Ceil(beats-1e-6), 1))
+	}
+	restart := s.offGrid || meter != s.barMeter
+	s.offGrid = !whole
+	if !restart {
+		return timingPoints
+	}
+	s.barMeter = meter
+
+	// a red line from a BPM change right before the section only needs its meter changed
+	for i := len(timingPoints) - 1; i >= 0; i-- {
+		if timingPoints[i].Uninherited && timingPoints[i].Time == start {
+			timingPoints[i].Meter = meter
+			return timingPoints
+		}
+	}
+
+	effects := types.EffectNone
+	if kiai {
+		effects = types.EffectKiaiTime
+	}
+	timingPoints = append(timingPoints, types.TimingPoint{
+		Time:        start,
+		BeatLength:  60 * 1000 / s.bpm,
+		Meter:       meter,
 		SampleSet:   0,
 		SampleIndex: 0,
 		Volume:      100,
 		Uninherited: true,
-		Effects:     types.EffectNone,
+		Effects:     effects,
+		Source:      s.source(-1, -1, ""),
 	})
-
-	return osuFile, nil
+	// a red line resets the SV, so it's set again unless a green line at the same time already does
+	hasGreen := slices.ContainsFunc(timingPoints, func(timingPoint types.TimingPoint) bool {
+		return !timingPoint.Uninherited && timingPoint.Time == start
+	})
+	if s.sv != -100 && !hasGreen {
+		timingPoints = append(timingPoints, types.TimingPoint{
+			Time:        start,
+			BeatLength:  s.sv,
+			Meter:       meter,
+			SampleSet:   0,
+			SampleIndex: 0,
+			Volume:      100,
+			Uninherited: false,
+			Effects:     effects,
+			Source:      s.source(-1, -1, ""),
+		})
+	}
+	return timingPoints
 }
 
-func parseSections(
-	section string,
-	startTime int,
-	elapsedTime *float64,
-	bpm float64,
-	beats *uint,
-	prevBeats uint,
-	holdNotes map[uint]int,
-	in24thMode *bool,
-	inBindZone *bool,
-) ([]types.HitObject, []types.TimingPoint) {
+func parseSections(section string, state *parseState) ([]types.HitObject, []types.TimingPoint) {
 	rows := strings.Split(section, ",")
-	beatLength := 60 * 1000 / bpm
+	beatLength := 60 * 1000 / state.bpm
 	var hitObjects []types.HitObject
 	var timingPoints []types.TimingPoint
 
-	for _, row := range rows {
-		time := startTime + int(*elapsedTime) - int(beatLength/4)
-		notes := strings.SplitSeq(row, "")
+	for rowIndex, row := range rows {
+		time := state.startTime + int(state.elapsedTime) - int(beatLength/4)
+		notes := strings.Split(row, "")
+		// a row opening or closing 24th mode is a 24th row itself
+		rowsPerBeat := state.rowsPerBeat
 
-		for note := range notes {
+		for column, note := range notes {
 			if unicode.IsDigit(rune(note[0])) { // normal notes
 				lane, _ := strconv.Atoi(note)
+				if lane < 1 || lane > 8 {
+					state.warn(WarningIgnoredCharacter, rowIndex, time, fmt.Sprintf("unknown note %q ignored", note))
+					continue
+				}
 				if lane > 4 { // convert attack notes into normal notes
 					lane -= 4
+					state.warnings = warnOnce(state.warnings, Warning{
+						Kind:    WarningAttackNote,
+						Level:   state.level,
+						Section: state.section,
+						Row:     rowIndex,
+						Time:    time,
+						Message: "attack note converted into a normal note",
+					})
 				}
 
+				state.checkPlacement(uint(lane), rowIndex, time)
+				state.laneFreeAt[uint(lane)] = time
+
 				hitObjects = append(hitObjects, types.HitObject{
 					XPosition: int16((512 * lane / 4) - 64),
 					YPosition: 192,
@@ -189,22 +547,33 @@ func parseSections(
 						Index:       0,
 						Volume:      0,
 					},
+					Source: state.source(rowIndex, column, note),
 				})
 			} else if unicode.IsLetter(rune(note[0])) { // hold notes
 				// convert letter into alphabet index (i.e. lane)
 				lane := uint(unicode.ToLower(rune(note[0]))) - uint('a') + 1
 
 				if lane <= 4 {
-					holdNotes[lane] = time
+					if hold, ok := state.holdNotes[lane]; ok {
+						state.warn(WarningDroppedHold, hold.row, hold.time, fmt.Sprintf("hold note in column %d is restarted before it ends, dropped", lane))
+					} else {
+						state.checkPlacement(lane, rowIndex, time)
+					}
+					state.holdNotes[lane] = holdStart{
+						time:    time,
+						section: state.section,
+						row:     rowIndex,
+						source:  state.source(rowIndex, column, note),
+					}
 				} else if lane <= 8 {
 					lane -= 4
-					startTime, ok := holdNotes[lane]
+					hold, ok := state.holdNotes[lane]
 
 					if ok {
 						hitObjects = append(hitObjects, types.HitObject{
 							XPosition: int16((512 * lane / 4) - 64),
 							YPosition: 192,
-							Time:      startTime,
+							Time:      hold.time,
 							Type:      types.HoldNote,
 							HitSound:  types.HitSoundNormal,
 							ObjectParams: types.ObjectParams{
@@ -216,118 +585,175 @@ func parseSections(
 								Index:       0,
 								Volume:      0,
 							},
+							Source: hold.source,
 						})
-						delete(holdNotes, lane)
+						delete(state.holdNotes, lane)
+						state.laneFreeAt[lane] = time
+					} else {
+						state.warn(WarningDroppedHold, rowIndex, time, fmt.Sprintf("hold note end in column %d has no start, dropped", lane))
 					}
+				} else {
+					state.warn(WarningIgnoredCharacter, rowIndex, time, fmt.Sprintf("unknown hold note %q ignored", note))
 				}
 			} else { // modifiers
-				if note == "(" && !*in24thMode {
-					*in24thMode = true
-					*beats = 6
+				if note == "(" && !state.in24thMode {
+					state.in24thMode = true
+					state.rowsPerBeat, rowsPerBeat = 6, 6
 					continue
-				} else if note == ")" && *in24thMode {
-					*in24thMode = false
-					*beats = prevBeats
+				} else if note == ")" && state.in24thMode {
+					state.in24thMode = false
+					state.rowsPerBeat = 4
 					continue
-				} else if note == "[" && !*inBindZone {
-					*inBindZone = true
+				} else if note == "[" && !state.inBindZone {
+					state.inBindZone = true
+					state.bindZones = append(state.bindZones, BindZone{Start: time, End: time})
+					if state.bindZone != BindZoneKiai {
+						continue
+					}
 					timingPoints = append(timingPoints, types.TimingPoint{
 						Time:        time,
-						BeatLength:  -100,
-						Meter:       *beats,
+						BeatLength:  state.sv,
+						Meter:       state.meter,
 						SampleSet:   0,
 						SampleIndex: 0,
 						Volume:      100,
 						Uninherited: false,
 						Effects:     types.EffectKiaiTime,
+						Source:      state.source(rowIndex, column, note),
 					})
 					continue
-				} else if note == "]" && *inBindZone {
-					*inBindZone = false
+				} else if note == "]" && state.inBindZone {
+					state.inBindZone = false
+					state.bindZones[len(state.bindZones)-1].End = time
+					state.bindZones[len(state.bindZones)-1].Closed = true
+					if state.bindZone != BindZoneKiai {
+						continue
+					}
 					timingPoints = append(timingPoints, types.TimingPoint{
 						Time:        time,
-						BeatLength:  -100,
-						Meter:       *beats,
+						BeatLength:  state.sv,
+						Meter:       state.meter,
 						SampleSet:   0,
 						SampleIndex: 0,
 						Volume:      100,
 						Uninherited: false,
 						Effects:     types.EffectNone,
+						Source:      state.source(rowIndex, column, note),
 					})
 					continue
 				}
+				state.warn(WarningIgnoredCharacter, rowIndex, time, fmt.Sprintf("unexpected %q ignored", note))
 			}
 		}
 
-		*elapsedTime += beatLength / float64(*beats)
+		state.elapsedTime += beatLength / float64(rowsPerBeat)
 	}
 
 	return hitObjects, timingPoints
 }
 
-func parseMapOptions(
-	mapOptions map[string]interface{},
-	startTime int,
-	elapsedTime float64,
-	bpm *float64,
-	beats uint,
-	baseBPM float64,
-) []types.TimingPoint {
+// checkPlacement warns about notes that land before the song starts or on top of another object in the same column
+func (s *parseState) checkPlacement(lane uint, row int, time int) {
+	if time < 0 {
+		s.warn(WarningNegativeTime, row, time, fmt.Sprintf("note in column %d is placed at %dms, before the audio starts", lane, time))
+	}
+
+	if _, ok := s.holdNotes[lane]; ok {
+		s.warn(WarningNoteCollision, row, time, fmt.Sprintf("note in column %d overlaps a hold note", lane))
+	} else if freeAt, ok := s.laneFreeAt[lane]; ok && time <= freeAt {
+		s.warn(WarningNoteCollision, row, time, fmt.Sprintf("note in column %d collides with another note at %dms", lane, freeAt))
+	}
+}
+
+func parseMapOptions(mapOptions map[string]interface{}, state *parseState) []types.TimingPoint {
 	var opts types.MapOptions
 	mapBytes, _ := json.Marshal(mapOptions)
+	warnTime := state.startTime + int(state.elapsedTime)
 
-	if err := json.Unmarshal(mapBytes, &opts); err == nil {
-		if opts.BPM != nil {
-			if *opts.BPM == 0 {
-				*bpm = 1e-6 // bpm cannot be zero, so we set it to a small value (0.000001)
-			} else {
-				*bpm = *opts.BPM
-			}
+	if err := json.Unmarshal(mapBytes, &opts); err != nil {
+		state.warn(WarningIgnoredOption, -1, warnTime, fmt.Sprintf("invalid map options %s ignored: %v", mapBytes, err))
+		return []types.TimingPoint{}
+	}
+
+	keys := make([]string, 0, len(mapOptions))
+	for key := range mapOptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case "bpm", "speed":
+		case "barLine":
+			state.warn(WarningIgnoredOption, -1, warnTime, "bar line toggles are not supported, ignored")
+		default:
+			state.warn(WarningIgnoredOption, -1, warnTime, fmt.Sprintf("unknown map option %q ignored", key))
 		}
-		beatLength := 60 * 1000 / *bpm
-		time := startTime + int(elapsedTime) - int(beatLength/4)
-
-		if opts.BPM != nil {
-			return []types.TimingPoint{
-				{
-					Time:        time,
-					BeatLength:  beatLength,
-					Meter:       beats,
-					SampleSet:   0,
-					SampleIndex: 0,
-					Volume:      100,
-					Uninherited: true,
-					Effects:     types.EffectNone,
-				},
-				{
-					Time:        time,
-					BeatLength:  -100 / (baseBPM / *bpm), // keep scroll speed relative to base BPM
-					Meter:       beats,
-					SampleSet:   0,
-					SampleIndex: 0,
-					Volume:      100,
-					Uninherited: false,
-					Effects:     types.EffectNone,
-				},
-			}
-		} else if opts.Speed != nil {
-			var speed float64
-			if *opts.Speed == 0 {
-				speed = 1e-6 // speed cannot be zero, so we set it to a small value (0.000001)
-			} else {
-				speed = *opts.Speed
+	}
+
+	if opts.BPM != nil && !isValidNumber(*opts.BPM) && *opts.BPM != 0 {
+		state.warn(WarningIgnoredOption, -1, warnTime, fmt.Sprintf("invalid BPM %v ignored", *opts.BPM))
+		opts.BPM = nil
+	}
+	if opts.Speed != nil && !isValidNumber(*opts.Speed) && *opts.Speed != 0 {
+		state.warn(WarningIgnoredOption, -1, warnTime, fmt.Sprintf("invalid speed %v ignored", *opts.Speed))
+		opts.Speed = nil
+	}
+
+	if opts.BPM != nil && *opts.BPM != 0 {
+		state.bpm = *opts.BPM
+	}
+	beatLength := 60 * 1000 / state.bpm
+	time := state.startTime + int(state.elapsedTime) - int(beatLength/4)
+
+	if opts.BPM != nil && opts.Speed != nil {
+		state.warn(WarningIgnoredOption, -1, time, "speed set alongside a BPM change, ignored")
+	}
+
+	// a BPM of 0 would make every row last forever, so it's treated as a stop instead: rows keep the
+	// previous BPM's timing while the scroll is frozen, until a BPM change resumes it
+	if opts.BPM != nil && *opts.BPM == 0 {
+		if state.scroll == ScrollConstant {
+			// without SV there's nothing to stop the scroll with
+			state.warn(WarningZeroBPM, -1, time, fmt.Sprintf("BPM of 0 dropped as constant scroll has no stops, rows keep the timing of %v BPM", state.bpm))
+		} else {
+			state.warn(WarningZeroBPM, -1, time, fmt.Sprintf("BPM of 0 converted into a stop, rows keep the timing of %v BPM until the next BPM change", state.bpm))
+		}
+		state.stopped = true
+		return state.svChange(time)
+	}
+
+	if opts.BPM != nil {
+		// Sparebeat's speed starts over at every BPM change, and so do the bar lines
+		state.stopped = false
+		state.speed = 1
+		state.barMeter, state.offGrid = state.meter, false
+
+		redLine := types.TimingPoint{
+			Time:        time,
+			BeatLength:  beatLength,
+			Meter:       state.meter,
+			SampleSet:   0,
+			SampleIndex: 0,
+			Volume:      100,
+			Uninherited: true,
+			Effects:     types.EffectNone,
+			Source:      state.source(-1, -1, ""),
+		}
+		// a red line resets the SV to 1x by itself
+		state.sv = -100
+		return append([]types.TimingPoint{redLine}, state.svChange(time)...)
+	} else if opts.Speed != nil {
+		if state.stopped {
+			if state.scroll != ScrollConstant {
+				state.warn(WarningIgnoredOption, -1, time, "speed change during a stop ignored")
 			}
-			return []types.TimingPoint{{
-				Time:        time,
-				BeatLength:  -100 / speed,
-				Meter:       beats,
-				SampleSet:   0,
-				SampleIndex: 0,
-				Volume:      100,
-				Uninherited: false,
-				Effects:     types.EffectNone,
-			}}
+			return []types.TimingPoint{}
+		}
+		if *opts.Speed == 0 && state.scroll != ScrollConstant {
+			state.warn(WarningZeroSpeed, -1, time, "speed of 0 replaced by the slowest speed osu! supports, 0.01x")
 		}
+		state.speed = *opts.Speed
+		return state.svChange(time)
 	}
 
 	return []types.TimingPoint{}
@@ -365,6 +791,11 @@ func getBPM(bpmRaw interface{}) float64 {
 	}
 }
 
+// isValidNumber reports whether a BPM or speed is usable, i.e. positive & finite
+func isValidNumber(f float64) bool {
+	return f > 0 && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
 func isNumeric(str string) bool {
 	for _, char := range str {
 		if !unicode.IsDigit(char) {
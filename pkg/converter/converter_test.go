@@ -0,0 +1,662 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/audio"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// run `go test ./pkg/converter -update` to regenerate the golden files after an intended change
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+func TestConvertGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string // defaults to name
+		opts    Options
+		leadIn  bool // apply ApplyLeadIn like the CLI does
+		levels  []string
+	}{
+		{name: "bpm-change", levels: []string{"Easy"}},
+		{name: "speed-change", levels: []string{"Normal"}},
+		{name: "stops", levels: []string{"Hard"}},
+		{name: "stops-constant", fixture: "stops", opts: Options{Scroll: ScrollConstant}, levels: []string{"Hard"}},
+		{name: "slow-intro", levels: []string{"Hard"}},
+		{name: "slow-intro-constant", fixture: "slow-intro", opts: Options{Scroll: ScrollConstant}, levels: []string{"Hard"}},
+		{name: "slow-intro-native", fixture: "slow-intro", opts: Options{Scroll: ScrollNative}, levels: []string{"Hard"}},
+		{name: "24th-mode", levels: []string{"Hard"}},
+		{name: "three-four", levels: []string{"Normal"}},
+		{name: "bind-zones", levels: []string{"Easy", "Normal"}},
+		{name: "bind-zones-storyboard", fixture: "bind-zones", opts: Options{BindZones: BindZoneStoryboard}, levels: []string{"Easy", "Normal"}},
+		{name: "bind-zones-bookmarks", fixture: "bind-zones", opts: Options{BindZones: BindZoneBookmarks}, levels: []string{"Easy", "Normal"}},
+		{name: "bind-zones-none", fixture: "bind-zones", opts: Options{BindZones: BindZoneNone}, levels: []string{"Easy", "Normal"}},
+		{name: "storyboard", fixture: "bind-zones", opts: Options{Storyboard: true}, levels: []string{"Easy", "Normal"}},
+		{name: "attack-notes", levels: []string{"Hard"}},
+		{name: "holds", levels: []string{"Easy", "Hard"}},
+		{name: "string-levels", levels: []string{"Easy"}},
+		{name: "breaks", levels: []string{"Easy", "Hard"}},
+		{name: "breaks-disabled", fixture: "breaks", opts: Options{BreakThreshold: -1}, levels: []string{"Easy", "Hard"}},
+		{name: "lead-in", fixture: "breaks", opts: Options{Offset: -600}, leadIn: true, levels: []string{"Easy", "Hard"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := tt.fixture
+			if fixture == "" {
+				fixture = tt.name
+			}
+			result := convertFixture(t, fixture, tt.opts)
+			if tt.leadIn {
+				result.Warnings = append(result.Warnings, ApplyLeadIn(&result.Map)...)
+			}
+
+			var levels []string
+			for _, diff := range result.Map.Difficulties {
+				levels = append(levels, diff.Metadata.Version)
+			}
+			if strings.Join(levels, ",") != strings.Join(tt.levels, ",") {
+				t.Fatalf("converted levels = %v, want %v", levels, tt.levels)
+			}
+
+			for _, diff := range result.Map.Difficulties {
+				var buf bytes.Buffer
+				if err := WriteOsuContent(diff, &buf); err != nil {
+					t.Fatalf("WriteOsuContent(%s) error: %v", diff.Metadata.Version, err)
+				}
+				compareGolden(t, filepath.Join("testdata", "golden", tt.name, diff.Metadata.Version+".osu"), buf.Bytes())
+			}
+
+			if len(result.Map.Storyboard.List) > 0 {
+				var buf bytes.Buffer
+				if err := WriteOsbContent(result.Map.Storyboard, &buf); err != nil {
+					t.Fatalf("WriteOsbContent error: %v", err)
+				}
+				compareGolden(t, filepath.Join("testdata", "golden", tt.name, "storyboard.osb"), buf.Bytes())
+			}
+
+			var warnings strings.Builder
+			for _, warning := range result.Warnings {
+				warnings.WriteString(warning.String() + "\n")
+			}
+			compareGolden(t, filepath.Join("testdata", "golden", tt.name, "warnings.txt"), []byte(warnings.String()))
+		})
+	}
+}
+
+func TestConvertInvalidBPM(t *testing.T) {
+	for _, bpm := range []interface{}{nil, float64(0), float64(-120), "NaN", "Inf", "fast"} {
+		sbMap := types.SparebeatMap{
+			BPM:   bpm,
+			Level: types.Level{Hard: float64(1)},
+			Map:   types.MapData{Hard: []interface{}{"1,2,3,4"}},
+		}
+		if _, err := ConvertSparebeatToOsu(sbMap); err == nil {
+			t.Errorf("ConvertSparebeatToOsu with BPM %#v returned no error", bpm)
+		}
+	}
+}
+
+func TestUnclosedBindZone(t *testing.T) {
+	result := convertFixture(t, "bind-zones", Options{})
+
+	zones := result.BindZones["Normal"]
+	if len(zones) != 2 {
+		t.Fatalf("got %d bind zones, want 2", len(zones))
+	}
+	if !zones[0].Closed || zones[1].Closed {
+		t.Errorf("closed = %v, %v, want true, false", zones[0].Closed, zones[1].Closed)
+	}
+	if zones[1].End <= zones[1].Start {
+		t.Errorf("unclosed bind zone ends at %d, before it starts at %d", zones[1].End, zones[1].Start)
+	}
+}
+
+func TestKiaiBindZones(t *testing.T) {
+	timingPoints := []types.TimingPoint{
+		{Time: 3000, Effects: types.EffectNone},
+		{Time: 1000, Effects: types.EffectKiaiTime},
+		{Time: 0, Uninherited: true},
+		{Time: 4000, Effects: types.EffectKiaiTime},
+	}
+
+	zones := KiaiBindZones(timingPoints)
+	if len(zones) != 2 {
+		t.Fatalf("got %d zones, want 2", len(zones))
+	}
+	if zones[0] != (BindZone{Start: 1000, End: 3000, Closed: true}) {
+		t.Errorf("first zone = %+v", zones[0])
+	}
+	if zones[1].Start != 4000 || zones[1].Closed {
+		t.Errorf("second zone = %+v, want an unclosed zone from 4000", zones[1])
+	}
+}
+
+func TestStoryboardTitleCard(t *testing.T) {
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{title: "Bind Zones", want: true},
+		{title: "バインド", want: false},
+		{title: "", want: false},
+	}
+
+	for _, tt := range tests {
+		storyboard, files, warnings := GenerateStoryboard(types.SparebeatMap{Title: tt.title}, 1000)
+		_, ok := files[TitleFileName]
+		if ok != tt.want {
+			t.Errorf("title card for %q generated = %v, want %v", tt.title, ok, tt.want)
+		}
+		if ok == (len(warnings) > 0) {
+			t.Errorf("title card for %q generated = %v with %d warnings", tt.title, ok, len(warnings))
+		}
+		if _, ok := files[GradientFileName]; !ok || len(storyboard.List) == 0 {
+			t.Errorf("no background gradient for %q", tt.title)
+		}
+	}
+}
+
+func TestRegistryIDs(t *testing.T) {
+	registry, err := ReadRegistry(strings.NewReader(`{
+		"stable": {"bindzones": {"beatmapSetId": 10, "beatmapIds": {"Easy": 11}}},
+		"beta": {"bindzones": {"beatmapSetId": 20, "beatmapIds": {"Easy": 21, "Normal": 22}}}
+	}`))
+	if err != nil {
+		t.Fatalf("ReadRegistry error: %v", err)
+	}
+
+	ids, ok := registry.Lookup("bindzones", true)
+	if !ok {
+		t.Fatal("beta map missing from registry")
+	}
+	if _, ok := registry.Lookup("missing", false); ok {
+		t.Error("found a map that isn't in the registry")
+	}
+
+	result := convertFixture(t, "bind-zones", Options{Beta: true, IDs: ids})
+	for _, diff := range result.Map.Difficulties {
+		if diff.Metadata.BeatmapSetID != 20 || diff.Metadata.BeatmapID != ids.Difficulties[diff.Metadata.Version] {
+			t.Errorf("%s has IDs %d/%d, want 20/%d", diff.Metadata.Version, diff.Metadata.BeatmapSetID, diff.Metadata.BeatmapID, ids.Difficulties[diff.Metadata.Version])
+		}
+		if tags := strings.Join(diff.Metadata.Tags, " "); !strings.HasPrefix(tags, "sparebeat beta bindzones ") {
+			t.Errorf("%s tags = %q, want them to start with the source", diff.Metadata.Version, tags)
+		}
+	}
+}
+
+func TestPreviewTime(t *testing.T) {
+	zones := convertFixture(t, "bind-zones", Options{}).BindZones
+	firstZone := min(zones["Easy"][0].Start, zones["Normal"][0].Start)
+
+	tests := []struct {
+		opts Options
+		want int
+	}{
+		{opts: Options{Preview: PreviewBindZone}, want: firstZone},
+		{opts: Options{Preview: PreviewTime, PreviewTime: 1234}, want: 1234},
+		{opts: Options{Preview: PreviewNone}, want: -1},
+	}
+
+	for _, tt := range tests {
+		result := convertFixture(t, "bind-zones", tt.opts)
+		for _, diff := range result.Map.Difficulties {
+			if diff.General.PreviewTime != tt.want {
+				t.Errorf("%s preview time with %+v = %d, want %d", diff.Metadata.Version, tt.opts, diff.General.PreviewTime, tt.want)
+			}
+		}
+	}
+}
+
+func TestDensestTime(t *testing.T) {
+	var osuFile types.OsuFile
+	// a sparse intro, then 20 notes a second from 30s on
+	for time := 0; time < 30000; time += 1000 {
+		osuFile.HitObjects.List = append(osuFile.HitObjects.List, types.HitObject{Time: time})
+	}
+	for time := 30000; time < 40000; time += 50 {
+		osuFile.HitObjects.List = append(osuFile.HitObjects.List, types.HitObject{Time: time})
+	}
+
+	result := Result{Map: types.OsuMap{Difficulties: []types.OsuFile{osuFile}}}
+	if got := densestTime(result); got != 30000 {
+		t.Errorf("densestTime() = %d, want 30000", got)
+	}
+}
+
+func TestCheckAudio(t *testing.T) {
+	// 100 frames of silence at 128 kbps, 44100 Hz, about 2.6 seconds
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	mp3 := bytes.Repeat(frame, 100)
+
+	var osuFile types.OsuFile
+	osuFile.Metadata.Version = "Hard"
+	for _, time := range []int{1000, 2000, 3000, 4000} {
+		osuFile.HitObjects.List = append(osuFile.HitObjects.List, types.HitObject{Time: time})
+	}
+	osuMap := types.OsuMap{Difficulties: []types.OsuFile{osuFile}}
+
+	_, warnings, err := CheckAudio(osuMap, mp3)
+	if err != nil {
+		t.Fatalf("CheckAudio() error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Kind != WarningAfterAudioEnd || warnings[0].Time != 3000 || warnings[0].Count != 2 {
+		t.Errorf("CheckAudio() warnings = %+v, want 2 notes after the audio ends from 3000ms", warnings)
+	}
+
+	_, warnings, err = CheckAudio(osuMap, make([]byte, 2000))
+	if err != nil || len(warnings) != 1 || warnings[0].Kind != WarningNotMP3 || warnings[0].Count != 1 {
+		t.Errorf("CheckAudio(unknown) = %+v, %v, want a %s warning", warnings, err, WarningNotMP3)
+	}
+
+	// 2.5 seconds of FLAC, which osu! can't play
+	flac := []byte("fLaC\x80\x00\x00\x22\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0a\xc4\x42\xf0\x00\x01\xae\xaa")
+	flac = append(flac, make([]byte, 16)...)
+	info, warnings, err := CheckAudio(osuMap, flac)
+	if err != nil || info.Format != audio.FormatFLAC || info.Duration != 2500 {
+		t.Fatalf("CheckAudio(FLAC) = %+v, %v, want 2500ms of FLAC", info, err)
+	}
+	if len(warnings) != 2 || warnings[0].Kind != WarningUnplayableAudio || warnings[0].Count != 1 || warnings[1].Kind != WarningAfterAudioEnd {
+		t.Errorf("CheckAudio(FLAC) warnings = %+v, want %s & %s warnings", warnings, WarningUnplayableAudio, WarningAfterAudioEnd)
+	}
+
+	_, _, err = CheckAudio(osuMap, []byte("<html>Not Found</html>"))
+	if err == nil {
+		t.Error("CheckAudio(HTML) succeeded, want an error")
+	}
+}
+
+func TestApplyAudioTags(t *testing.T) {
+	result := convertFixture(t, "bind-zones", Options{})
+	osuMap := result.Map
+	ApplyAudioTags(&osuMap, audio.Tags{Title: "夜に駆ける", Album: "THE BOOK", Genre: "J-Pop Rock"})
+
+	for _, metadata := range []types.MetadataSection{osuMap.Metadata, osuMap.Difficulties[0].Metadata} {
+		if metadata.TitleUnicode != "夜に駆ける" || metadata.Source != "THE BOOK" {
+			t.Errorf("metadata = %+v, want the title & source from the tags", metadata)
+		}
+		if metadata.ArtistUnicode != result.Map.Metadata.ArtistUnicode {
+			t.Errorf("ArtistUnicode = %q, want it unchanged without an artist tag", metadata.ArtistUnicode)
+		}
+		if tags := metadata.Tags; tags[len(tags)-1] != "j-pop_rock" {
+			t.Errorf("Tags = %v, want the genre last", tags)
+		}
+	}
+	if len(result.Map.Metadata.Tags) == len(osuMap.Metadata.Tags) {
+		t.Error("ApplyAudioTags() changed the tags of the original map")
+	}
+}
+
+func TestOffset(t *testing.T) {
+	base := convertFixture(t, "bind-zones", Options{})
+	moved := convertFixture(t, "bind-zones", Options{Offset: 1000})
+
+	for i, diff := range moved.Map.Difficulties {
+		for j, hitObject := range diff.HitObjects.List {
+			if want := base.Map.Difficulties[i].HitObjects.List[j].Time + 1000; hitObject.Time != want {
+				t.Fatalf("%s note %d at %d, want %d", diff.Metadata.Version, j, hitObject.Time, want)
+			}
+		}
+	}
+	if moved.Map.General.PreviewTime != base.Map.General.PreviewTime+1000 {
+		t.Errorf("PreviewTime = %d, want %d", moved.Map.General.PreviewTime, base.Map.General.PreviewTime+1000)
+	}
+}
+
+func TestAlignAudio(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	audible := append([]byte(nil), frame...)
+	audible[7] = 0xff // side information claiming there's data
+	mp3 := append(bytes.Repeat(frame, 5), bytes.Repeat(audible, 5)...)
+
+	tests := []struct {
+		name        string
+		noteTime    int
+		trimSilence bool
+		wantShift   int
+	}{
+		{name: "note before the audio", noteTime: -50, wantShift: 52},
+		{name: "trim silence", noteTime: 500, trimSilence: true, wantShift: -131},
+		{name: "trim up to the first note", noteTime: 60, trimSilence: true, wantShift: -52},
+		{name: "nothing to do", noteTime: 500, wantShift: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var osuFile types.OsuFile
+			osuFile.HitObjects.List = []types.HitObject{{Time: tt.noteTime}}
+			osuFile.TimingPoints.List = []types.TimingPoint{{Time: 0, BeatLength: 500, Uninherited: true}}
+			osuMap := types.OsuMap{Difficulties: []types.OsuFile{osuFile}}
+
+			_, shift, err := AlignAudio(&osuMap, mp3, tt.trimSilence)
+			if err != nil {
+				t.Fatalf("AlignAudio() error: %v", err)
+			}
+			diff := osuMap.Difficulties[0]
+			if shift != tt.wantShift || diff.HitObjects.List[0].Time != tt.noteTime+tt.wantShift || diff.TimingPoints.List[0].Time != tt.wantShift {
+				t.Errorf("AlignAudio() shifted by %d (note at %d), want %d", shift, diff.HitObjects.List[0].Time, tt.wantShift)
+			}
+		})
+	}
+}
+
+func TestAlignAudioNotMP3(t *testing.T) {
+	ogg := append([]byte("OggS\x00\x02"), make([]byte, 21)...)
+	ogg = append(ogg, make([]byte, 30)...)
+	copy(ogg[28:], "\x01vorbis")
+	ogg[26], ogg[27] = 1, 30
+
+	var osuFile types.OsuFile
+	osuFile.HitObjects.List = []types.HitObject{{Time: -50}}
+	osuMap := types.OsuMap{Difficulties: []types.OsuFile{osuFile}}
+
+	aligned, shift, err := AlignAudio(&osuMap, ogg, false)
+	if err == nil || shift != 0 || !bytes.Equal(aligned, ogg) {
+		t.Errorf("AlignAudio(OGG) = %d, %v, want the audio unchanged & an error", shift, err)
+	}
+	if time := osuMap.Difficulties[0].HitObjects.List[0].Time; time != -50 {
+		t.Errorf("note moved to %d, want it left for ApplyLeadIn", time)
+	}
+}
+
+func TestOszRoundTrip(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	mp3 := bytes.Repeat(frame, 10)
+
+	source, err := os.ReadFile(filepath.Join("testdata", "bind-zones.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{BindZones: BindZoneBookmarks, Offset: -1000, IDs: BeatmapIDs{SetID: 12345}}
+	result := convertFixture(t, "bind-zones", opts)
+	osuMap := result.Map
+	osuMap.Source = source
+
+	// the same post-processing as the CLI, which the .osz has to be read back with
+	ApplyAudioTags(&osuMap, audio.Tags{Title: "夜に駆ける", Genre: "J-Pop"})
+	aligned, shift, err := AlignAudio(&osuMap, mp3, false)
+	if err != nil || shift <= 0 {
+		t.Fatalf("AlignAudio() = %d, %v, want the audio padded", shift, err)
+	}
+	osuMap.Files = map[string][]byte{SetAudioFilename(&osuMap, audio.FormatMP3): aligned}
+	ApplyLeadIn(&osuMap)
+	err = EmbedSource(&osuMap, "bind-zones", map[string]string{
+		"bindZones": "bookmarks",
+		"breaks":    "5000",
+		"offset":    "-1000",
+		"preview":   "densest",
+		"shift":     strconv.Itoa(shift),
+	})
+	if err != nil {
+		t.Fatalf("EmbedSource() error: %v", err)
+	}
+
+	var osz bytes.Buffer
+	if err := WriteOszContent(osuMap, &osz); err != nil {
+		t.Fatalf("WriteOszContent() error: %v", err)
+	}
+	format, err := LookupFormat("osz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// options the .osz wasn't made with shouldn't change what's read back
+	restored, err := format.Read(&osz, Options{BindZones: BindZoneKiai, Scroll: ScrollConstant})
+	if err != nil {
+		t.Fatalf("reading .osz error: %v", err)
+	}
+
+	for _, warning := range restored.Warnings {
+		if warning.Kind == WarningEditedDifficulty {
+			t.Errorf("reading .osz warned: %s", warning)
+		}
+	}
+	if len(restored.Map.Difficulties) != len(osuMap.Difficulties) {
+		t.Fatalf("read %d difficulties, want %d", len(restored.Map.Difficulties), len(osuMap.Difficulties))
+	}
+	for i, diff := range restored.Map.Difficulties {
+		var got, want bytes.Buffer
+		if err := WriteOsuContent(diff, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteOsuContent(osuMap.Difficulties[i], &want); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s differs from the converted .osu:\n--- got ---\n%s\n--- want ---\n%s", diff.Metadata.Version, got.String(), want.String())
+		}
+	}
+	if restored.Map.Metadata.TitleUnicode != "夜に駆ける" || restored.Map.General.AudioFilename != "audio.mp3" {
+		t.Errorf("map header = %+v, %+v, want the tags & audio file name of the .osz", restored.Map.General, restored.Map.Metadata)
+	}
+}
+
+func TestSetAudioFilename(t *testing.T) {
+	osuMap := types.OsuMap{Difficulties: make([]types.OsuFile, 2)}
+	for format, want := range map[audio.Format]string{audio.FormatOGG: "audio.ogg", audio.FormatFLAC: "audio.flac", "": "audio.mp3"} {
+		if name := SetAudioFilename(&osuMap, format); name != want {
+			t.Errorf("SetAudioFilename(%q) = %q, want %q", format, name, want)
+		}
+		if osuMap.General.AudioFilename != want || osuMap.Difficulties[1].General.AudioFilename != want {
+			t.Errorf("AudioFilename = %q, want %q on the map & every difficulty", osuMap.Difficulties[1].General.AudioFilename, want)
+		}
+	}
+}
+
+func TestSixEight(t *testing.T) {
+	sbMap := types.SparebeatMap{
+		BPM:       float64(180),
+		Beats:     6,
+		StartTime: 1000,
+		Level:     types.Level{Hard: float64(1)},
+		Map: types.MapData{Hard: []interface{}{
+			strings.TrimSuffix(strings.Repeat("1,,,,,,2,,,,,,", 2), ","),
+			strings.TrimSuffix(strings.Repeat("3,,,,,,4,,,,,,", 2), ","),
+			"1",
+		}},
+	}
+	result, err := ConvertSparebeatToOsu(sbMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := result.Map.Difficulties[0]
+
+	// rows stay 16th notes, only the bar lines change
+	if got := diff.TimingPoints.List; len(got) != 1 || got[0].Meter != 6 || got[0].Time != 1000-83 {
+		t.Errorf("timing points = %+v, want a single 6/4 red line on the first row", got)
+	}
+	if last := diff.HitObjects.List[len(diff.HitObjects.List)-1]; last.Time != 1000-83+int(48*60*1000/180/4) {
+		t.Errorf("last note at %d, want it 48 rows after the first", last.Time)
+	}
+}
+
+func TestDominantBPM(t *testing.T) {
+	red := func(time int, bpm float64) types.TimingPoint {
+		return types.TimingPoint{Time: time, BeatLength: 60 * 1000 / bpm, Uninherited: true}
+	}
+	notes := func(end int) []types.HitObject {
+		return []types.HitObject{{Time: 0}, {Time: end - 500, ObjectParams: types.ObjectParams{EndTime: end}}}
+	}
+
+	tests := []struct {
+		name         string
+		timingPoints []types.TimingPoint
+		end          int
+		want         float64
+	}{
+		{name: "single BPM", timingPoints: []types.TimingPoint{red(0, 150)}, end: 10000, want: 150},
+		{name: "slow intro", timingPoints: []types.TimingPoint{red(0, 60), red(4000, 180)}, end: 10000, want: 180},
+		{name: "BPM that returns", timingPoints: []types.TimingPoint{red(0, 120), red(3000, 200), red(6000, 120)}, end: 10000, want: 120},
+		{name: "points after the last note", timingPoints: []types.TimingPoint{red(0, 100), red(5000, 200), red(20000, 300)}, end: 9000, want: 100},
+		{name: "tie", timingPoints: []types.TimingPoint{red(5000, 200), red(0, 100)}, end: 10000, want: 100},
+		{name: "no red lines", timingPoints: []types.TimingPoint{{Time: 0, BeatLength: -100}}, end: 10000, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var diff types.OsuFile
+			diff.TimingPoints.List = tt.timingPoints
+			diff.HitObjects.List = notes(tt.end)
+			if got := DominantBPM(diff); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("DominantBPM() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampTimingPoints(t *testing.T) {
+	red := func(time int, beatLength float64) types.TimingPoint {
+		return types.TimingPoint{Time: time, BeatLength: beatLength, Meter: 4, Uninherited: true}
+	}
+	green := func(time int, speed float64) types.TimingPoint {
+		return types.TimingPoint{Time: time, BeatLength: -100 / speed}
+	}
+
+	tests := []struct {
+		name string
+		list []types.TimingPoint
+		want []types.TimingPoint
+	}{
+		{
+			name: "by a measure",
+			list: []types.TimingPoint{red(-100, 500), red(5000, 400)},
+			want: []types.TimingPoint{red(1900, 500), red(5000, 400)},
+		},
+		{
+			name: "by a beat before the next red line",
+			list: []types.TimingPoint{red(-100, 500), red(1000, 400)},
+			want: []types.TimingPoint{red(400, 500), red(1000, 400)},
+		},
+		{
+			name: "replaced by a red line at 0ms",
+			list: []types.TimingPoint{red(-100, 500), red(0, 400)},
+			want: []types.TimingPoint{red(0, 400)},
+		},
+		{
+			name: "last speed change before 0ms",
+			list: []types.TimingPoint{green(-300, 2), red(-100, 500), green(-50, 0.5), green(200, 1.5)},
+			want: []types.TimingPoint{green(0, 0.5), green(200, 1.5), red(1900, 500), green(1900, 1.5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clampTimingPoints(tt.list)
+			if len(got) != len(tt.want) {
+				t.Fatalf("clampTimingPoints() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("clampTimingPoints()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClampHitObjects(t *testing.T) {
+	note := func(time int, x int16) types.HitObject {
+		return types.HitObject{XPosition: x, Time: time, Type: types.HitCircle}
+	}
+	list := []types.HitObject{note(-200, 64), note(-100, 64), note(-100, 192), note(0, 192), note(100, 320)}
+
+	got, moved, dropped := clampHitObjects(list)
+	want := []types.HitObject{note(0, 64), note(0, 192), note(100, 320)}
+	if moved != 1 || dropped != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("clampHitObjects() = %+v, %d moved, %d dropped, want %+v, 1 moved, 2 dropped", got, moved, dropped, want)
+	}
+}
+
+func TestIsLevelEnabled(t *testing.T) {
+	tests := []struct {
+		level interface{}
+		want  bool
+	}{
+		{level: nil, want: false},
+		{level: float64(0), want: false},
+		{level: float64(-1), want: false},
+		{level: float64(7), want: true},
+		{level: "7", want: true},
+		{level: "0", want: false},
+		{level: "-1", want: false},
+		{level: "EX", want: false},
+		{level: true, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isLevelEnabled(tt.level); got != tt.want {
+			t.Errorf("isLevelEnabled(%#v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestGetBPM(t *testing.T) {
+	tests := []struct {
+		bpm  interface{}
+		want float64
+	}{
+		{bpm: nil, want: 0},
+		{bpm: float64(150), want: 150},
+		{bpm: "175.5", want: 175.5},
+		{bpm: "fast", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := getBPM(tt.bpm); got != tt.want {
+			t.Errorf("getBPM(%#v) = %v, want %v", tt.bpm, got, tt.want)
+		}
+	}
+}
+
+func convertFixture(t *testing.T, name string, opts Options) Result {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sbMap types.SparebeatMap
+	if err := json.Unmarshal(data, &sbMap); err != nil {
+		t.Fatalf("invalid fixture %s: %v", name, err)
+	}
+
+	result, err := ConvertSparebeatToOsuWithOptions(sbMap, opts)
+	if err != nil {
+		t.Fatalf("ConvertSparebeatToOsuWithOptions(%s) error: %v", name, err)
+	}
+	return result
+}
+
+func compareGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file:\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+func FuzzParseSections(f *testing.F) {
+	f.Add("1,,2,,3,,4,,a,,,e,5,,8,", 150.0, uint(4))
+	f.Add("23,,(a3),4,,e,,,[67]", 120.0, uint(3))
+	f.Add("(1,2,3,4,1,2)", 0.0, uint(0))
+	f.Add("[,],[,]", -1.0, uint(1))
+	f.Add("ad,,eh,bc,,fg,0,9,z,é,\xff", 1e-6, uint(6))
+
+	f.Fuzz(func(t *testing.T, section string, bpm float64, beats uint) {
+		state := newParseState("Hard", 0, bpm, beats)
+		hitObjects, _ := parseSections(section, state)
+
+		for _, hitObject := range hitObjects {
+			switch hitObject.XPosition {
+			case 64, 192, 320, 448:
+			default:
+				t.Fatalf("hit object in invalid column at x=%d", hitObject.XPosition)
+			}
+		}
+	})
+}
+
+func FuzzConvertSparebeatToOsu(f *testing.F) {
+	fixtures, _ := filepath.Glob(filepath.Join("testdata", "*.json"))
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte(`{"bpm":0,"level":{"hard":1},"map":{"hard":["1"]}}`))
+	f.Add([]byte(`{"bpm":"x","beats":0,"level":{"easy":"1"},"map":{"easy":[{"bpm":-1},{"speed":0},"a,e"]}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var sbMap types.SparebeatMap
+		if err := json.Unmarshal(data, &sbMap); err != nil {
+			return
+		}
+
+		result, err := ConvertSparebeatToOsu(sbMap)
+		if err != nil {
+			return
+		}
+
+		for _, diff := range result.Map.Difficulties {
+			if err := WriteOsuContent(diff, &bytes.Buffer{}); err != nil {
+				t.Fatalf("WriteOsuContent error: %v", err)
+			}
+		}
+	})
+}
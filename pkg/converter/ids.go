@@ -0,0 +1,36 @@
+package converter
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// BeatmapIDs are the osu! IDs a converted map was submitted under
+type BeatmapIDs struct {
+	SetID        int            `json:"beatmapSetId"`
+	Difficulties map[string]int `json:"beatmapIds"` // level name (Easy, Normal or Hard) -> beatmap ID
+}
+
+// Registry is a local file of osu! IDs for Sparebeat maps, so reconverted maps keep their IDs, e.g.
+//
+//	{"stable": {"<map id>": {"beatmapSetId": 1, "beatmapIds": {"Hard": 2}}}, "beta": {}}
+type Registry struct {
+	Stable map[string]BeatmapIDs `json:"stable"`
+	Beta   map[string]BeatmapIDs `json:"beta"`
+}
+
+func ReadRegistry(r io.Reader) (Registry, error) {
+	var registry Registry
+	err := json.NewDecoder(r).Decode(&registry)
+	return registry, err
+}
+
+// Lookup finds the IDs of a Sparebeat map, stable and beta maps having separate IDs
+func (r Registry) Lookup(id string, beta bool) (BeatmapIDs, bool) {
+	maps := r.Stable
+	if beta {
+		maps = r.Beta
+	}
+	ids, ok := maps[id]
+	return ids, ok
+}
@@ -0,0 +1,180 @@
+package converter
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+const minLeadTime = 2000 // ms players get before the first note, osu! waits with the audio for the rest
+
+// ApplyLeadIn makes a converted map safe to play from the start: timing points & notes before 0ms are moved
+// to 0ms or later, and AudioLeadIn gives players time to react to the first note. It runs after AlignAudio,
+// which can instead make room for early notes by padding the audio.
+func ApplyLeadIn(osuMap *types.OsuMap) []Warning {
+	var warnings []Warning
+	first := math.MaxInt
+	for i := range osuMap.Difficulties {
+		diff := &osuMap.Difficulties[i]
+		diff.TimingPoints.List = clampTimingPoints(diff.TimingPoints.List)
+
+		var moved, dropped int
+		diff.HitObjects.List, moved, dropped = clampHitObjects(diff.HitObjects.List)
+		if moved > 0 {
+			warnings = append(warnings, Warning{
+				Kind:    WarningNegativeTime,
+				Level:   diff.Metadata.Version,
+				Section: -1,
+				Row:     -1,
+				Count:   moved,
+				Message: "notes before the audio starts were moved to 0ms",
+			})
+		}
+		if dropped > 0 {
+			// a note at 0ms is kept over one moved there
+			warnings = append(warnings, Warning{
+				Kind:    WarningNoteCollision,
+				Level:   diff.Metadata.Version,
+				Section: -1,
+				Row:     -1,
+				Count:   dropped,
+				Message: "notes before the audio starts were dropped, as their column already has a note at 0ms",
+			})
+		}
+
+		for _, hitObject := range diff.HitObjects.List {
+			first = min(first, hitObject.Time)
+		}
+	}
+	if first == math.MaxInt {
+		return warnings
+	}
+
+	leadIn := max(minLeadTime-first, 0)
+	osuMap.General.AudioLeadIn = leadIn
+	for i := range osuMap.Difficulties {
+		osuMap.Difficulties[i].General.AudioLeadIn = leadIn
+	}
+	return warnings
+}
+
+// clampTimingPoints moves timing points before 0ms forward. Uninherited ones move by whole measures or beats where
+// they can, so the beat grid stays where it was, while inherited ones only matter from 0ms on anyway.
+func clampTimingPoints(timingPoints []types.TimingPoint) []types.TimingPoint {
+	if !slices.ContainsFunc(timingPoints, func(timingPoint types.TimingPoint) bool { return timingPoint.Time < 0 }) {
+		return timingPoints
+	}
+
+	list := append([]types.TimingPoint(nil), timingPoints...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time < list[j].Time
+	})
+
+	// only the last inherited point before 0ms still has an effect
+	lastInherited := -1
+	for i, timingPoint := range list {
+		if timingPoint.Time < 0 && !timingPoint.Uninherited {
+			lastInherited = i
+		}
+	}
+
+	var clamped []types.TimingPoint
+	var moved []int // where uninherited points were moved to
+	for i, timingPoint := range list {
+		if timingPoint.Time >= 0 {
+			clamped = append(clamped, timingPoint)
+			continue
+		}
+		if !timingPoint.Uninherited {
+			if i == lastInherited {
+				timingPoint.Time = 0
+				clamped = append(clamped, timingPoint)
+			}
+			continue
+		}
+
+		// stay before the next uninherited point, which takes over from there
+		limit := math.MaxInt
+		for _, next := range list[i+1:] {
+			if next.Uninherited {
+				limit = next.Time
+				break
+			}
+		}
+		time := 0
+		for _, step := range []float64{timingPoint.BeatLength * float64(max(timingPoint.Meter, 1)), timingPoint.BeatLength} {
+			if step <= 0 {
+				continue
+			}
+			moved := int(math.Round(float64(timingPoint.Time) + math.Ceil(-float64(timingPoint.Time)/step)*step))
+			if moved < limit {
+				time = moved
+				break
+			}
+		}
+		if time >= limit {
+			continue // a later point at 0ms replaces it
+		}
+		timingPoint.Time = time
+		clamped = append(clamped, timingPoint)
+		moved = append(moved, time)
+	}
+
+	// a red line resets the speed, so the speed change it moved past has to be repeated after it
+	for _, time := range moved {
+		speed := -1
+		for i, timingPoint := range clamped {
+			if !timingPoint.Uninherited && timingPoint.Time <= time {
+				speed = i
+			}
+		}
+		if speed >= 0 && clamped[speed].Time < time {
+			repeated := clamped[speed]
+			repeated.Time = time
+			clamped = append(clamped, repeated)
+		}
+	}
+
+	// clamped inherited points go after an uninherited point at 0ms, which would otherwise reset their speed
+	sort.SliceStable(clamped, func(i, j int) bool {
+		if clamped[i].Time != clamped[j].Time {
+			return clamped[i].Time < clamped[j].Time
+		}
+		return clamped[i].Uninherited && !clamped[j].Uninherited
+	})
+	return clamped
+}
+
+// clampHitObjects moves notes before 0ms to 0ms, dropping any that end up on top of another note in their column.
+// It returns the notes with how many were moved & how many were dropped.
+func clampHitObjects(hitObjects []types.HitObject) ([]types.HitObject, int, int) {
+	moved, dropped := 0, 0
+	taken := make(map[int16]bool) // columns with a note at 0ms
+	for _, hitObject := range hitObjects {
+		if hitObject.Time == 0 {
+			taken[hitObject.XPosition] = true
+		}
+	}
+
+	list := make([]types.HitObject, 0, len(hitObjects))
+	for _, hitObject := range hitObjects {
+		if hitObject.Time < 0 {
+			if taken[hitObject.XPosition] {
+				dropped++
+				continue
+			}
+			moved++
+			taken[hitObject.XPosition] = true
+			hitObject.Time = 0
+			// a hold that ended before 0ms has nothing left to hold
+			if hitObject.Type&types.HoldNote != 0 && hitObject.ObjectParams.EndTime <= 0 {
+				hitObject.Type = hitObject.Type&^types.HoldNote | types.HitCircle
+				hitObject.ObjectParams.EndTime = 0
+			}
+		}
+		list = append(list, hitObject)
+	}
+	return list, moved, dropped
+}
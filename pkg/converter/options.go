@@ -0,0 +1,66 @@
+package converter
+
+import "fmt"
+
+// BindZoneMode picks how Sparebeat bind zones show up in the converted map
+type BindZoneMode string
+
+const (
+	BindZoneKiai       BindZoneMode = "kiai"       // kiai time, flashing the playfield
+	BindZoneStoryboard BindZoneMode = "storyboard" // a tinted storyboard overlay
+	BindZoneBookmarks  BindZoneMode = "bookmarks"  // editor bookmarks at the start & end of each zone
+	BindZoneNone       BindZoneMode = "none"
+)
+
+var BindZoneModes = []BindZoneMode{BindZoneKiai, BindZoneStoryboard, BindZoneBookmarks, BindZoneNone}
+
+func ParseBindZoneMode(s string) (BindZoneMode, error) {
+	for _, mode := range BindZoneModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown bind zone mode %q", s)
+}
+
+// Options controls how a Sparebeat map is converted.
+// The zero value converts maps the same way ConvertSparebeatToOsu does.
+type Options struct {
+	BindZones  BindZoneMode // defaults to kiai, or storyboard when a storyboard is generated
+	Storyboard bool         // generate an .osb reproducing Sparebeat's visuals
+	Beta       bool         // the map is from beta.sparebeat.com, which is noted in the tags
+	IDs        BeatmapIDs   // osu! IDs to write into the map, 0 if unsubmitted
+
+	Preview     PreviewMode // defaults to densest
+	PreviewTime int         // ms, used with PreviewTime
+
+	BreakThreshold int // ms without notes that become a break, 0 for the default of 5 seconds & negative for no breaks
+
+	Offset int // ms to move the whole chart by, positive is later
+
+	Scroll ScrollMode // defaults to faithful
+}
+
+func (o Options) bindZones() BindZoneMode {
+	if o.BindZones == "" {
+		if o.Storyboard {
+			return BindZoneStoryboard
+		}
+		return BindZoneKiai
+	}
+	return o.BindZones
+}
+
+func (o Options) breakThreshold() int {
+	if o.BreakThreshold == 0 {
+		return defaultBreakThreshold
+	}
+	return o.BreakThreshold
+}
+
+func (o Options) scroll() ScrollMode {
+	if o.Scroll == "" {
+		return ScrollFaithful
+	}
+	return o.Scroll
+}
@@ -0,0 +1,76 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PreviewMode picks where osu!'s song select starts playing the song
+type PreviewMode string
+
+const (
+	PreviewDensest  PreviewMode = "densest"   // the busiest stretch of notes across all levels
+	PreviewBindZone PreviewMode = "bind-zone" // the first bind zone, or the densest stretch without any
+	PreviewTime     PreviewMode = "time"      // Options.PreviewTime
+	PreviewNone     PreviewMode = "none"      // let osu! pick, which plays from the start
+)
+
+var PreviewModes = []PreviewMode{PreviewDensest, PreviewBindZone, PreviewTime, PreviewNone}
+
+func ParsePreviewMode(s string) (PreviewMode, error) {
+	for _, mode := range PreviewModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown preview mode %q", s)
+}
+
+const previewWindow = 10000 // ms, about as long as song select plays before looping
+
+// previewTime picks the preview point of a converted map, -1 meaning unset
+func previewTime(result Result, opts Options) int {
+	switch opts.Preview {
+	case PreviewNone:
+		return -1
+	case PreviewTime:
+		return opts.PreviewTime
+	case PreviewBindZone:
+		first := -1
+		for _, zones := range result.BindZones {
+			if len(zones) > 0 && (first == -1 || zones[0].Start < first) {
+				first = zones[0].Start
+			}
+		}
+		if first >= 0 {
+			return first
+		}
+	}
+	return densestTime(result)
+}
+
+// densestTime finds the first note of the window with the most notes in it, over every level
+func densestTime(result Result) int {
+	var times []int
+	for _, diff := range result.Map.Difficulties {
+		for _, hitObject := range diff.HitObjects.List {
+			times = append(times, hitObject.Time)
+		}
+	}
+	if len(times) == 0 {
+		return -1
+	}
+	sort.Ints(times)
+
+	best, bestCount := times[0], 0
+	last := 0
+	for first := range times {
+		for last < len(times) && times[last]-times[first] < previewWindow {
+			last++
+		}
+		if last-first > bestCount {
+			best, bestCount = times[first], last-first
+		}
+	}
+	return max(best, 0)
+}
@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// Format describes a chart format that SpareChange can read from and/or write to.
+// Readers decode into the osu! model, and writers encode from it, so any
+// readable format can be converted into any writable one.
+type Format struct {
+	Name          string
+	Extensions    []string
+	Read          func(r io.Reader, opts Options) (Result, error)
+	Write         func(osuMap types.OsuMap, w io.Writer) error
+	PerDifficulty bool // Write takes a map with a single difficulty, like a .osu file
+}
+
+func (f Format) CanRead() bool {
+	return f.Read != nil
+}
+
+func (f Format) CanWrite() bool {
+	return f.Write != nil
+}
+
+var formats []Format
+
+func init() {
+	RegisterFormat(Format{
+		Name:       "sparebeat",
+		Extensions: []string{".json"},
+		Read:       readSparebeat,
+		Write:      writeSparebeat,
+	})
+	RegisterFormat(Format{
+		Name:          "osu",
+		Extensions:    []string{".osu"},
+		Write:         writeOsu,
+		PerDifficulty: true,
+	})
+	RegisterFormat(Format{
+		Name:          "osu-annotated",
+		Write:         writeOsuAnnotated,
+		PerDifficulty: true,
+	})
+	RegisterFormat(Format{
+		Name:       "osz",
+		Extensions: []string{".osz"},
+		Read:       readOsz,
+		Write:      WriteOszContent,
+	})
+}
+
+// RegisterFormat adds a format to the registry, replacing any format with the same name.
+func RegisterFormat(format Format) {
+	for i, f := range formats {
+		if f.Name == format.Name {
+			formats[i] = format
+			return
+		}
+	}
+	formats = append(formats, format)
+}
+
+func Formats() []Format {
+	return append([]Format(nil), formats...)
+}
+
+func LookupFormat(name string) (Format, error) {
+	for _, f := range formats {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unknown format %q", name)
+}
+
+func DetectFormat(path string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return Format{}, fmt.Errorf("cannot detect format of %q without a file extension", path)
+	}
+
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	return Format{}, fmt.Errorf("no format registered for extension %q", ext)
+}
+
+// ResolveFormat looks up a format by name, or detects it from the path if no name is given.
+func ResolveFormat(name string, path string) (Format, error) {
+	if name != "" {
+		return LookupFormat(name)
+	}
+	return DetectFormat(path)
+}
+
+func readSparebeat(r io.Reader, opts Options) (Result, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var sbMap types.SparebeatMap
+	if err := json.Unmarshal(source, &sbMap); err != nil {
+		return Result{}, fmt.Errorf("invalid Sparebeat map: %w", err)
+	}
+
+	result, err := ConvertSparebeatToOsuWithOptions(sbMap, opts)
+	result.Map.Source = source
+	return result, err
+}
+
+func writeOsu(osuMap types.OsuMap, w io.Writer) error {
+	if len(osuMap.Difficulties) != 1 {
+		return fmt.Errorf("an .osu file holds exactly one difficulty, but the map has %d", len(osuMap.Difficulties))
+	}
+	return WriteOsuContent(osuMap.Difficulties[0], w)
+}
+
+func writeOsuAnnotated(osuMap types.OsuMap, w io.Writer) error {
+	if len(osuMap.Difficulties) != 1 {
+		return fmt.Errorf("an .osu file holds exactly one difficulty, but the map has %d", len(osuMap.Difficulties))
+	}
+	return WriteOsuContentWithSources(osuMap.Difficulties[0], w)
+}
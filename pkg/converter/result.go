@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+type Result struct {
+	Map      types.OsuMap
+	Warnings []Warning
+
+	// level name -> bind zones, kept regardless of how they're represented in the map
+	BindZones map[string][]BindZone
+}
+
+type BindZone struct {
+	Start  int
+	End    int
+	Closed bool // false if the zone has no closing bracket and lasts until the end of the map
+}
+
+// KiaiBindZones reads bind zones back from kiai time, the default way they're converted
+func KiaiBindZones(timingPoints []types.TimingPoint) []BindZone {
+	timingPoints = append([]types.TimingPoint(nil), timingPoints...)
+	sort.SliceStable(timingPoints, func(i, j int) bool {
+		return timingPoints[i].Time < timingPoints[j].Time
+	})
+
+	var zones []BindZone
+	inKiai := false
+	for _, timingPoint := range timingPoints {
+		kiai := timingPoint.Effects&types.EffectKiaiTime != 0
+		if kiai && !inKiai {
+			zones = append(zones, BindZone{Start: timingPoint.Time, End: timingPoint.Time})
+		} else if !kiai && inKiai {
+			zones[len(zones)-1].End = timingPoint.Time
+			zones[len(zones)-1].Closed = true
+		}
+		inKiai = kiai
+	}
+
+	// kiai time that's never turned off lasts until the end of the map
+	if inKiai {
+		zones[len(zones)-1].End = math.MaxInt32
+	}
+	return zones
+}
@@ -0,0 +1,359 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// Version is the SpareChange version recorded in conversion manifests,
+// set at build time with -ldflags "-X github.com/cxntered/SpareChange/pkg/converter.Version=..."
+var Version = "dev"
+
+const (
+	SourceFileName   = "sparebeat.json"
+	ManifestFileName = "sparechange.json"
+)
+
+// Manifest describes how an .osz was converted, so it can be traced back to its Sparebeat map
+type Manifest struct {
+	Tool     string            `json:"tool"`
+	Version  string            `json:"version"`
+	SourceID string            `json:"sourceId,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+
+	// .osu file name -> SHA-256 of its contents, used to tell which difficulties were edited after conversion
+	Difficulties map[string]string `json:"difficulties"`
+}
+
+var errNoSource = errors.New("converting osu! beatmaps to Sparebeat is not supported yet, only maps with an embedded Sparebeat source can be restored")
+
+// EmbedSource adds the original Sparebeat map & a conversion manifest to the map's bundled files.
+// It should be called after the difficulties are final, since the manifest records their contents.
+func EmbedSource(osuMap *types.OsuMap, sourceID string, options map[string]string) error {
+	if len(osuMap.Source) == 0 {
+		return errors.New("map has no Sparebeat source to embed")
+	}
+
+	manifest := Manifest{
+		Tool:         "SpareChange",
+		Version:      Version,
+		SourceID:     sourceID,
+		Options:      options,
+		Difficulties: make(map[string]string),
+	}
+
+	for _, diff := range osuMap.Difficulties {
+		var buf bytes.Buffer
+		err := WriteOsuContent(diff, &buf)
+		if err != nil {
+			return err
+		}
+		manifest.Difficulties[OsuFileName(diff)] = hashContent(buf.Bytes())
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if osuMap.Files == nil {
+		osuMap.Files = make(map[string][]byte)
+	}
+	osuMap.Files[SourceFileName] = osuMap.Source
+	osuMap.Files[ManifestFileName] = manifestBytes
+	return nil
+}
+
+// readOsz restores a map from an .osz that has an embedded Sparebeat source, converting it with the options
+// & audio shift recorded in its manifest so it matches the difficulties in the .osz. Difficulties that were edited in osu! since conversion are dropped, as they can't be converted back yet.
+func readOsz(r io.Reader, opts Options) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid .osz file: %w", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return Result{}, err
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return Result{}, err
+		}
+		files[file.Name] = content
+	}
+
+	source, ok := files[SourceFileName]
+	if !ok {
+		return Result{}, errNoSource
+	}
+	var manifest Manifest
+	err = json.Unmarshal(files[ManifestFileName], &manifest)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid conversion manifest: %w", err)
+	}
+
+	// convert the way the .osz was made, not the way the caller would convert it now
+	opts, err = manifestOptions(manifest.Options, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	shift := 0
+	if recorded := manifest.Options["shift"]; recorded != "" {
+		shift, err = strconv.Atoi(recorded)
+		if err != nil {
+			return Result{}, fmt.Errorf("invalid shift in conversion manifest: %w", err)
+		}
+	}
+
+	result, err := readSparebeat(bytes.NewReader(source), opts)
+	if err != nil {
+		return result, err
+	}
+
+	// levels left out of the conversion aren't in the manifest, & the lead-in depends on which levels are there
+	var converted []types.OsuFile
+	for _, diff := range result.Map.Difficulties {
+		if _, ok := manifest.Difficulties[OsuFileName(diff)]; ok {
+			converted = append(converted, diff)
+		}
+	}
+	result.Map.Difficulties = converted
+	Shift(&result.Map, shift)
+	ApplyLeadIn(&result.Map)
+
+	var diffs []types.OsuFile
+	for _, diff := range result.Map.Difficulties {
+		name := OsuFileName(diff)
+		content, ok := files[name]
+		if !ok {
+			result.Warnings = append(result.Warnings, Warning{
+				Kind:    WarningEditedDifficulty,
+				Level:   diff.Metadata.Version,
+				Section: -1,
+				Row:     -1,
+				Count:   1,
+				Message: fmt.Sprintf("%q is missing from the .osz, dropped", name),
+			})
+			continue
+		}
+		if hashContent(content) != manifest.Difficulties[name] {
+			result.Warnings = append(result.Warnings, Warning{
+				Kind:    WarningEditedDifficulty,
+				Level:   diff.Metadata.Version,
+				Section: -1,
+				Row:     -1,
+				Count:   1,
+				Message: fmt.Sprintf("%q was edited after conversion and can't be converted back yet, dropped", name),
+			})
+			continue
+		}
+
+		// the audio file name & metadata from its tags aren't part of the Sparebeat map
+		restoreHeader(&diff, content)
+		var buf bytes.Buffer
+		err = WriteOsuContent(diff, &buf)
+		if err != nil {
+			return result, err
+		}
+		if !bytes.Equal(buf.Bytes(), content) {
+			result.Warnings = append(result.Warnings, Warning{
+				Kind:    WarningEditedDifficulty,
+				Level:   diff.Metadata.Version,
+				Section: -1,
+				Row:     -1,
+				Count:   1,
+				Message: fmt.Sprintf("%q couldn't be rebuilt from the embedded Sparebeat map, dropped", name),
+			})
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	result.Map.Difficulties = diffs
+	if len(diffs) > 0 {
+		result.Map.General.AudioFilename = diffs[0].General.AudioFilename
+		result.Map.Metadata = diffs[0].Metadata
+	}
+
+	result.Map.Files = make(map[string][]byte)
+	for name, content := range files {
+		if strings.EqualFold(path.Ext(name), ".osu") || name == SourceFileName || name == ManifestFileName {
+			continue
+		}
+		result.Map.Files[name] = content
+	}
+
+	return result, nil
+}
+
+// manifestOptions rebuilds the options recorded in a conversion manifest,
+// keeping opts for anything an older manifest doesn't record
+func manifestOptions(recorded map[string]string, opts Options) (Options, error) {
+	var err error
+	for key, value := range recorded {
+		switch key {
+		case "beta":
+			opts.Beta, err = strconv.ParseBool(value)
+		case "storyboard":
+			opts.Storyboard, err = strconv.ParseBool(value)
+		case "bindZones":
+			opts.BindZones = ""
+			if value != "" {
+				opts.BindZones, err = ParseBindZoneMode(value)
+			}
+		case "scroll":
+			opts.Scroll = ""
+			if value != "" {
+				opts.Scroll, err = ParseScrollMode(value)
+			}
+		case "preview":
+			// the preview point is either a mode or a time
+			if ms, atoiErr := strconv.Atoi(value); atoiErr == nil {
+				opts.Preview, opts.PreviewTime = PreviewTime, ms
+			} else {
+				opts.Preview, err = ParsePreviewMode(value)
+			}
+		case "breaks":
+			opts.BreakThreshold, err = strconv.Atoi(value)
+			if opts.BreakThreshold <= 0 {
+				opts.BreakThreshold = -1
+			}
+		case "offset":
+			opts.Offset, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s option in conversion manifest: %w", key, err)
+		}
+	}
+	return opts, nil
+}
+
+// restoreHeader copies the audio file name & metadata from a converted .osu file into diff
+func restoreHeader(diff *types.OsuFile, content []byte) {
+	section := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+
+		metadata := &diff.Metadata
+		switch section + key {
+		case "[General]AudioFilename":
+			diff.General.AudioFilename = value
+		case "[Metadata]Title":
+			metadata.Title = value
+		case "[Metadata]TitleUnicode":
+			metadata.TitleUnicode = value
+		case "[Metadata]Artist":
+			metadata.Artist = value
+		case "[Metadata]ArtistUnicode":
+			metadata.ArtistUnicode = value
+		case "[Metadata]Creator":
+			metadata.Creator = value
+		case "[Metadata]Version":
+			metadata.Version = value
+		case "[Metadata]Source":
+			metadata.Source = value
+		case "[Metadata]Tags":
+			metadata.Tags = strings.Fields(value)
+		case "[Metadata]BeatmapID":
+			metadata.BeatmapID, _ = strconv.Atoi(value)
+		case "[Metadata]BeatmapSetID":
+			metadata.BeatmapSetID, _ = strconv.Atoi(value)
+		}
+	}
+}
+
+// writeSparebeat writes back the original Sparebeat map. When every converted level is
+// still present the source is written untouched, otherwise missing levels are disabled.
+func writeSparebeat(osuMap types.OsuMap, w io.Writer) error {
+	if len(osuMap.Source) == 0 {
+		return errNoSource
+	}
+
+	var sbMap types.SparebeatMap
+	err := json.Unmarshal(osuMap.Source, &sbMap)
+	if err != nil {
+		return fmt.Errorf("invalid embedded Sparebeat map: %w", err)
+	}
+
+	present := make(map[string]bool)
+	for _, diff := range osuMap.Difficulties {
+		present[strings.ToLower(diff.Metadata.Version)] = true
+	}
+
+	levels := map[string]interface{}{
+		"easy":   sbMap.Level.Easy,
+		"normal": sbMap.Level.Normal,
+		"hard":   sbMap.Level.Hard,
+	}
+	var missing []string
+	for _, name := range []string{"easy", "normal", "hard"} {
+		if isLevelEnabled(levels[name]) && !present[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) == 0 {
+		_, err = w.Write(osuMap.Source)
+		return err
+	}
+
+	// decode generically so fields SpareChange doesn't know about survive
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(osuMap.Source))
+	decoder.UseNumber()
+	err = decoder.Decode(&raw)
+	if err != nil {
+		return fmt.Errorf("invalid embedded Sparebeat map: %w", err)
+	}
+
+	level, _ := raw["level"].(map[string]interface{})
+	mapData, _ := raw["map"].(map[string]interface{})
+	for _, name := range missing {
+		if level != nil {
+			level[name] = 0
+		}
+		if mapData != nil {
+			mapData[name] = []interface{}{}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(raw)
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
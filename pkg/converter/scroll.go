@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// ScrollMode picks how Sparebeat's scroll speed is reproduced with osu! SV (inherited timing points)
+type ScrollMode string
+
+const (
+	ScrollFaithful ScrollMode = "faithful"   // Sparebeat's speed changes, with BPM changes cancelled out like Sparebeat does
+	ScrollConstant ScrollMode = "constant"   // no SV at all, speed changes & stops are dropped
+	ScrollNative   ScrollMode = "osu-native" // Sparebeat's speed changes, but BPM changes scroll faster or slower like in any osu! map
+)
+
+var ScrollModes = []ScrollMode{ScrollFaithful, ScrollConstant, ScrollNative}
+
+func ParseScrollMode(s string) (ScrollMode, error) {
+	for _, mode := range ScrollModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scroll mode %q", s)
+}
+
+// DominantBPM is the BPM a difficulty spends the most time in, up to its last note. osu! scrolls at 1x
+// at this BPM, so SV is normalized against it rather than the first BPM, which is often a slow intro.
+func DominantBPM(diff types.OsuFile) float64 {
+	var redLines []types.TimingPoint
+	for _, timingPoint := range diff.TimingPoints.List {
+		if timingPoint.Uninherited && timingPoint.BeatLength > 0 {
+			redLines = append(redLines, timingPoint)
+		}
+	}
+	if len(redLines) == 0 {
+		return 0
+	}
+	sort.SliceStable(redLines, func(i, j int) bool {
+		return redLines[i].Time < redLines[j].Time
+	})
+
+	end := 0
+	for _, hitObject := range diff.HitObjects.List {
+		end = max(end, hitObject.Time, hitObject.ObjectParams.EndTime)
+	}
+
+	// beat lengths are rounded so the same BPM written twice adds up
+	durations := make(map[float64]int)
+	for i, redLine := range redLines {
+		until := end
+		if i+1 < len(redLines) {
+			until = min(redLines[i+1].Time, end)
+		}
+		durations[math.Round(redLine.BeatLength*1000)/1000] += max(until-redLine.Time, 0)
+	}
+
+	// the earliest BPM wins ties, so a map without notes keeps its first BPM
+	dominant, longest := redLines[0].BeatLength, -1
+	for _, redLine := range redLines {
+		beatLength := math.Round(redLine.BeatLength*1000) / 1000
+		if durations[beatLength] > longest {
+			dominant, longest = redLine.BeatLength, durations[beatLength]
+		}
+	}
+	return 60 * 1000 / dominant
+}
+
+// svBeatLength is the inherited timing point beat length for a scroll speed multiplier,
+// limited to what osu! supports (0.01x to 10x) so a speed of 0 becomes the slowest scroll
+func svBeatLength(speed float64) float64 {
+	return max(min(-100/speed, -10), -10000)
+}
@@ -0,0 +1,55 @@
+package converter
+
+import "github.com/cxntered/SpareChange/pkg/types"
+
+// Shift moves everything timed in a converted map by ms milliseconds, positive is later
+func Shift(osuMap *types.OsuMap, ms int) {
+	if ms == 0 {
+		return
+	}
+
+	osuMap.General.PreviewTime = shiftPreviewTime(osuMap.General.PreviewTime, ms)
+	shiftEvents(osuMap.Events.List, ms)
+	shiftEvents(osuMap.Storyboard.List, ms)
+
+	for i := range osuMap.Difficulties {
+		diff := &osuMap.Difficulties[i]
+		diff.General.PreviewTime = shiftPreviewTime(diff.General.PreviewTime, ms)
+		for j := range diff.Editor.Bookmarks {
+			diff.Editor.Bookmarks[j] += ms
+		}
+		shiftEvents(diff.Events.List, ms)
+		for j := range diff.TimingPoints.List {
+			diff.TimingPoints.List[j].Time += ms
+		}
+		for j := range diff.HitObjects.List {
+			hitObject := &diff.HitObjects.List[j]
+			hitObject.Time += ms
+			if hitObject.Type&types.HoldNote != 0 {
+				hitObject.ObjectParams.EndTime += ms
+			}
+		}
+	}
+}
+
+// shiftPreviewTime leaves -1 alone, which lets osu! pick the preview point
+func shiftPreviewTime(previewTime int, ms int) int {
+	if previewTime < 0 {
+		return previewTime
+	}
+	return max(previewTime+ms, 0)
+}
+
+func shiftEvents(events []types.Event, ms int) {
+	for i := range events {
+		event := &events[i]
+		event.StartTime += ms
+		if event.EventType == types.EventTypeBreak {
+			event.EventParams.EndTime += ms
+		}
+		for j := range event.EventParams.Commands {
+			event.EventParams.Commands[j].StartTime += ms
+			event.EventParams.Commands[j].EndTime += ms
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+type SourceMapEntry struct {
+	Difficulty string          `json:"difficulty"`
+	Kind       string          `json:"kind"`  // "timingPoint" or "hitObject"
+	Index      int             `json:"index"` // position within the difficulty's timing points or hit objects
+	Time       int             `json:"time"`
+	Source     types.SourcePos `json:"source"`
+}
+
+// SourceMap lists where every converted timing point & hit object came from in the Sparebeat map.
+// Objects that weren't converted from anything (e.g. the initial timing point) are left out.
+func SourceMap(osuMap types.OsuMap) []SourceMapEntry {
+	var entries []SourceMapEntry
+
+	for _, diff := range osuMap.Difficulties {
+		for i, timingPoint := range diff.TimingPoints.List {
+			if timingPoint.Source == nil {
+				continue
+			}
+			entries = append(entries, SourceMapEntry{
+				Difficulty: diff.Metadata.Version,
+				Kind:       "timingPoint",
+				Index:      i,
+				Time:       timingPoint.Time,
+				Source:     *timingPoint.Source,
+			})
+		}
+
+		for i, hitObject := range diff.HitObjects.List {
+			if hitObject.Source == nil {
+				continue
+			}
+			entries = append(entries, SourceMapEntry{
+				Difficulty: diff.Metadata.Version,
+				Kind:       "hitObject",
+				Index:      i,
+				Time:       hitObject.Time,
+				Source:     *hitObject.Source,
+			})
+		}
+	}
+
+	return entries
+}
+
+func WriteSourceMap(osuMap types.OsuMap, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(SourceMap(osuMap))
+}
+
+func FormatSourcePos(pos types.SourcePos) string {
+	if pos.Row < 0 {
+		return fmt.Sprintf("%s: section %d (map options)", pos.Level, pos.Section)
+	}
+	return fmt.Sprintf("%s: section %d, row %d, column %d (%q)", pos.Level, pos.Section, pos.Row, pos.Column, pos.Char)
+}
@@ -0,0 +1,256 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+	"github.com/cxntered/SpareChange/pkg/utils"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	PixelFileName    = "sb/pixel.png" // a 1x1 white image that storyboard sprites scale & tint into solid shapes
+	GradientFileName = "sb/gradient.png"
+	TitleFileName    = "sb/title.png"
+)
+
+const (
+	// osu!'s storyboard space is 640x480, or 854x480 for widescreen storyboards
+	storyboardWidth  = 854
+	storyboardHeight = 480
+
+	bindZoneFade    = 200 // ms
+	bindZoneOpacity = 0.25
+
+	gradientFade = 1000 // ms
+
+	titleFade     = 500  // ms
+	titleDuration = 3000 // ms, including fades
+	titleScale    = 3
+	titlePadding  = 6 // px, before scaling
+)
+
+var bindZoneTint = color.NRGBA{R: 255, G: 80, B: 120, A: 255}
+
+func PixelImage() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	return encodePNG(img)
+}
+
+// GenerateStoryboard builds the storyboard shared by every difficulty, reproducing Sparebeat's
+// background gradient for the whole map & showing a title card at the start time.
+// It returns the storyboard's events along with the images they use.
+func GenerateStoryboard(sbMap types.SparebeatMap, endTime int) (types.EventsSection, map[string][]byte, []Warning) {
+	var storyboard types.EventsSection
+	var warnings []Warning
+	files := make(map[string][]byte)
+
+	startColor := utils.HexToNRGBA(utils.DefaultBgColor[0])
+	endColor := utils.HexToNRGBA(utils.DefaultBgColor[1])
+	if len(sbMap.BgColor) == 2 {
+		startColor = utils.HexToNRGBA(sbMap.BgColor[0])
+		endColor = utils.HexToNRGBA(sbMap.BgColor[1])
+	}
+
+	// a 1px wide gradient stretched over the whole screen
+	gradient := image.NewNRGBA(image.Rect(0, 0, 1, 256))
+	for y := range 256 {
+		gradient.SetNRGBA(0, y, utils.InterpolateColor(startColor, endColor, float64(y)/255))
+	}
+	files[GradientFileName] = encodePNG(gradient)
+
+	storyboard.List = append(storyboard.List, types.Event{
+		EventType: types.EventTypeSprite,
+		EventParams: types.EventParams{
+			FileName: GradientFileName,
+			XOffset:  320,
+			YOffset:  240,
+			Layer:    types.LayerBackground,
+			Origin:   types.OriginCentre,
+			Commands: []types.StoryboardCommand{
+				{
+					Type:      types.CommandVectorScale,
+					StartTime: 0,
+					EndTime:   endTime + gradientFade,
+					Params:    []float64{storyboardWidth, storyboardHeight / 256.0},
+				},
+				{
+					Type:      types.CommandFade,
+					StartTime: 0,
+					EndTime:   gradientFade,
+					Params:    []float64{0, 1},
+				},
+				{
+					Type:      types.CommandFade,
+					StartTime: endTime,
+					EndTime:   endTime + gradientFade,
+					Params:    []float64{1, 0},
+				},
+			},
+		},
+	})
+
+	title, ok := renderTitleCard(sbMap.Title, sbMap.Artist)
+	if !ok {
+		warnings = append(warnings, Warning{
+			Kind:    WarningStoryboard,
+			Section: -1,
+			Row:     -1,
+			Time:    sbMap.StartTime,
+			Count:   1,
+			Message: "title card left out of the storyboard, as the title or artist uses characters the built-in font can't draw",
+		})
+		return storyboard, files, warnings
+	}
+	files[TitleFileName] = encodePNG(title)
+
+	start := sbMap.StartTime
+	storyboard.List = append(storyboard.List, types.Event{
+		EventType: types.EventTypeSprite,
+		EventParams: types.EventParams{
+			FileName: TitleFileName,
+			XOffset:  320,
+			YOffset:  240,
+			Layer:    types.LayerForeground,
+			Origin:   types.OriginCentre,
+			Commands: []types.StoryboardCommand{
+				{
+					Type:      types.CommandScale,
+					StartTime: start,
+					EndTime:   start + titleDuration,
+					Params:    []float64{titleScale},
+				},
+				{
+					Type:      types.CommandMove,
+					Easing:    2, // ease in
+					StartTime: start,
+					EndTime:   start + titleFade,
+					Params:    []float64{320, 260, 320, 240},
+				},
+				{
+					Type:      types.CommandFade,
+					StartTime: start,
+					EndTime:   start + titleFade,
+					Params:    []float64{0, 1},
+				},
+				{
+					Type:      types.CommandFade,
+					StartTime: start + titleDuration - titleFade,
+					EndTime:   start + titleDuration,
+					Params:    []float64{1, 0},
+				},
+			},
+		},
+	})
+
+	return storyboard, files, warnings
+}
+
+// renderTitleCard draws the title & artist in white over a translucent backdrop, or returns
+// false if either uses characters the built-in font doesn't have
+func renderTitleCard(title string, artist string) (*image.NRGBA, bool) {
+	face := basicfont.Face7x13
+	lines := []string{title, artist}
+
+	width := 0
+	for _, line := range lines {
+		for _, r := range line {
+			if !hasGlyph(face, r) {
+				return nil, false
+			}
+		}
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	if width == 0 {
+		return nil, false
+	}
+
+	lineHeight := face.Metrics().Height.Ceil()
+	img := image.NewNRGBA(image.Rect(0, 0, width+titlePadding*2, lineHeight*len(lines)+titlePadding*2))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{A: 160}), image.Point{}, draw.Src)
+
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.White),
+		Face: face,
+	}
+	for i, line := range lines {
+		// center each line
+		x := titlePadding + (width-font.MeasureString(face, line).Ceil())/2
+		drawer.Dot = fixed.P(x, titlePadding+lineHeight*i+face.Metrics().Ascent.Ceil())
+		drawer.DrawString(line)
+	}
+
+	return img, true
+}
+
+// hasGlyph reports whether the font can draw r, as basicfont falls back to a placeholder instead of failing
+func hasGlyph(face *basicfont.Face, r rune) bool {
+	for _, rng := range face.Ranges {
+		if r >= rng.Low && r < rng.High && r != '\ufffd' {
+			return true
+		}
+	}
+	return false
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, img) // can't fail when writing to memory
+	return buf.Bytes()
+}
+
+// bindZoneSprites tints the screen for the duration of each bind zone
+func bindZoneSprites(zones []BindZone) []types.Event {
+	var events []types.Event
+
+	for _, zone := range zones {
+		fade := min(bindZoneFade, (zone.End-zone.Start)/2)
+
+		events = append(events, types.Event{
+			EventType: types.EventTypeSprite,
+			EventParams: types.EventParams{
+				FileName: PixelFileName,
+				XOffset:  320,
+				YOffset:  240,
+				Layer:    types.LayerForeground,
+				Origin:   types.OriginCentre,
+				Commands: []types.StoryboardCommand{
+					{
+						Type:      types.CommandVectorScale,
+						StartTime: zone.Start,
+						EndTime:   zone.End,
+						Params:    []float64{storyboardWidth, storyboardHeight},
+					},
+					{
+						Type:      types.CommandColour,
+						StartTime: zone.Start,
+						EndTime:   zone.End,
+						Params:    []float64{float64(bindZoneTint.R), float64(bindZoneTint.G), float64(bindZoneTint.B)},
+					},
+					{
+						Type:      types.CommandFade,
+						StartTime: zone.Start,
+						EndTime:   zone.Start + fade,
+						Params:    []float64{0, bindZoneOpacity},
+					},
+					{
+						Type:      types.CommandFade,
+						StartTime: zone.End - fade,
+						EndTime:   zone.End,
+						Params:    []float64{bindZoneOpacity, 0},
+					},
+				},
+			},
+		})
+	}
+
+	return events
+}
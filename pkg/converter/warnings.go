@@ -0,0 +1,65 @@
+package converter
+
+import "fmt"
+
+type WarningKind string
+
+const (
+	WarningDroppedHold      WarningKind = "dropped-hold"
+	WarningAttackNote       WarningKind = "attack-note"
+	WarningIgnoredOption    WarningKind = "ignored-option"
+	WarningIgnoredCharacter WarningKind = "ignored-character"
+	WarningZeroBPM          WarningKind = "zero-bpm"
+	WarningZeroSpeed        WarningKind = "zero-speed"
+	WarningNegativeTime     WarningKind = "negative-time"
+	WarningNoteCollision    WarningKind = "note-collision"
+	WarningEditedDifficulty WarningKind = "edited-difficulty"
+	WarningStoryboard       WarningKind = "storyboard"
+	WarningNotMP3           WarningKind = "not-mp3"
+	WarningAfterAudioEnd    WarningKind = "after-audio-end"
+	WarningUnplayableAudio  WarningKind = "unplayable-audio"
+)
+
+// Warning describes something that couldn't be converted faithfully.
+// Section is the index into the level's map data array and Row is the
+// row within that section, both -1 when they don't apply.
+type Warning struct {
+	Kind    WarningKind `json:"kind"`
+	Level   string      `json:"level,omitempty"`
+	Section int         `json:"section"`
+	Row     int         `json:"row"`
+	Time    int         `json:"time"`
+	Count   int         `json:"count"` // how many times this happened, for kinds that are grouped per level
+	Message string      `json:"message"`
+}
+
+func (w Warning) String() string {
+	s := ""
+	if w.Level != "" {
+		s += fmt.Sprintf("[%s] ", w.Level)
+	}
+	if w.Section >= 0 {
+		s += fmt.Sprintf("section %d", w.Section)
+		if w.Row >= 0 {
+			s += fmt.Sprintf(", row %d", w.Row)
+		}
+		s += ": "
+	}
+	s += w.Message
+	if w.Count > 1 {
+		s += fmt.Sprintf(" (%d times)", w.Count)
+	}
+	return s
+}
+
+// warnOnce groups repeated warnings of the same kind, keeping the location of the first one
+func warnOnce(warnings []Warning, warning Warning) []Warning {
+	for i := range warnings {
+		if warnings[i].Kind == warning.Kind && warnings[i].Level == warning.Level {
+			warnings[i].Count++
+			return warnings
+		}
+	}
+	warning.Count = 1
+	return append(warnings, warning)
+}
@@ -4,24 +4,57 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/cxntered/SpareChange/pkg/types"
+	"github.com/cxntered/SpareChange/pkg/utils"
 )
 
-func WriteOsuFile(osuFile types.OsuFile, filePath string) error {
-	f, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+func OsuFileName(osuFile types.OsuFile) string {
+	return utils.Sanitize(fmt.Sprintf("%s - %s (%s) [%s].osu",
+		osuFile.Metadata.Artist,
+		osuFile.Metadata.Title,
+		osuFile.Metadata.Creator,
+		osuFile.Metadata.Version,
+	))
+}
+
+func OsbFileName(osuMap types.OsuMap) string {
+	return utils.Sanitize(fmt.Sprintf("%s - %s (%s).osb",
+		osuMap.Metadata.Artist,
+		osuMap.Metadata.Title,
+		osuMap.Metadata.Creator,
+	))
+}
+
+func OszFileName(osuMap types.OsuMap) string {
+	return utils.Sanitize(fmt.Sprintf("%s - %s.osz",
+		osuMap.Metadata.Artist,
+		osuMap.Metadata.Title,
+	))
+}
 
-	return WriteOsuContent(osuFile, f)
+// submittedID is how a beatmap ID is written, osu! takes -1 for maps that were never submitted while 0 is looked up
+func submittedID(id int) int {
+	if id <= 0 {
+		return -1
+	}
+	return id
 }
 
 func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
+	return writeOsuContent(osuFile, writer, false)
+}
+
+// WriteOsuContentWithSources writes the .osu file with a comment above every timing point
+// & hit object pointing back to where it came from in the Sparebeat map
+func WriteOsuContentWithSources(osuFile types.OsuFile, writer io.Writer) error {
+	return writeOsuContent(osuFile, writer, true)
+}
+
+func writeOsuContent(osuFile types.OsuFile, writer io.Writer, withSources bool) error {
 	var sb strings.Builder
 	sb.WriteString("# Converted with github.com/cxntered/SpareChange\n")
 	sb.WriteString(fmt.Sprintf("osu file format v%d\n\n", osuFile.Version))
@@ -29,9 +62,26 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 	// general
 	sb.WriteString("[General]\n")
 	sb.WriteString(fmt.Sprintf("AudioFilename: %s\n", osuFile.General.AudioFilename))
+	sb.WriteString(fmt.Sprintf("AudioLeadIn: %d\n", osuFile.General.AudioLeadIn))
+	sb.WriteString(fmt.Sprintf("PreviewTime: %d\n", osuFile.General.PreviewTime))
 	sb.WriteString(fmt.Sprintf("Mode: %d\n", osuFile.General.Mode))
+	if osuFile.General.WidescreenStoryboard {
+		sb.WriteString("WidescreenStoryboard: 1\n")
+	}
 	sb.WriteString("\n")
 
+	// editor
+	if len(osuFile.Editor.Bookmarks) > 0 {
+		bookmarks := make([]string, 0, len(osuFile.Editor.Bookmarks))
+		for _, bookmark := range osuFile.Editor.Bookmarks {
+			bookmarks = append(bookmarks, strconv.Itoa(bookmark))
+		}
+
+		sb.WriteString("[Editor]\n")
+		sb.WriteString(fmt.Sprintf("Bookmarks: %s\n", strings.Join(bookmarks, ",")))
+		sb.WriteString("\n")
+	}
+
 	// metadata
 	sb.WriteString("[Metadata]\n")
 	sb.WriteString(fmt.Sprintf("Title: %s\n", osuFile.Metadata.Title))
@@ -41,6 +91,9 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 	sb.WriteString(fmt.Sprintf("Creator: %s\n", osuFile.Metadata.Creator))
 	sb.WriteString(fmt.Sprintf("Version: %s\n", osuFile.Metadata.Version))
 	sb.WriteString(fmt.Sprintf("Source: %s\n", osuFile.Metadata.Source))
+	sb.WriteString(fmt.Sprintf("Tags: %s\n", strings.Join(osuFile.Metadata.Tags, " ")))
+	sb.WriteString(fmt.Sprintf("BeatmapID: %d\n", submittedID(osuFile.Metadata.BeatmapID)))
+	sb.WriteString(fmt.Sprintf("BeatmapSetID: %d\n", submittedID(osuFile.Metadata.BeatmapSetID)))
 	sb.WriteString("\n")
 
 	// difficulty
@@ -55,29 +108,7 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 
 	// events
 	sb.WriteString("[Events]\n")
-	for _, event := range osuFile.Events.List {
-		switch event.EventType {
-		case types.EventTypeBackground:
-			sb.WriteString(fmt.Sprintf("0,%d,%s,%d,%d\n",
-				event.StartTime,
-				event.EventParams.FileName,
-				event.EventParams.XOffset,
-				event.EventParams.YOffset,
-			))
-		case types.EventTypeVideo:
-			sb.WriteString(fmt.Sprintf("1,%d,%s,%d,%d\n",
-				event.StartTime,
-				event.EventParams.FileName,
-				event.EventParams.XOffset,
-				event.EventParams.YOffset,
-			))
-		case types.EventTypeBreak:
-			sb.WriteString(fmt.Sprintf("2,%d,%d\n",
-				event.StartTime,
-				event.EventParams.EndTime,
-			))
-		}
-	}
+	writeEvents(&sb, osuFile.Events.List)
 	sb.WriteString("\n")
 
 	// timing points
@@ -88,6 +119,10 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 			uninherited = 1
 		}
 
+		if withSources && timingPoint.Source != nil {
+			sb.WriteString(fmt.Sprintf("// %s\n", FormatSourcePos(*timingPoint.Source)))
+		}
+
 		sb.WriteString(fmt.Sprintf("%d,%.2f,%d,%d,%d,%d,%d,%d\n",
 			timingPoint.Time,
 			timingPoint.BeatLength,
@@ -111,6 +146,10 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 			hitObject.HitSample.Volume,
 		)
 
+		if withSources && hitObject.Source != nil {
+			sb.WriteString(fmt.Sprintf("// %s\n", FormatSourcePos(*hitObject.Source)))
+		}
+
 		switch hitObject.Type {
 		case types.HitCircle:
 			sb.WriteString(fmt.Sprintf("%d,%d,%d,%d,%d,%s\n",
@@ -138,45 +177,148 @@ func WriteOsuContent(osuFile types.OsuFile, writer io.Writer) error {
 	return err
 }
 
-func ZipFiles(files []string, zipPath string) error {
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return err
+// WriteOsbContent writes a storyboard shared by every difficulty, with sprites grouped by layer
+func WriteOsbContent(storyboard types.EventsSection, writer io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("[Events]\n")
+
+	sb.WriteString("//Background and Video events\n")
+	var others []types.Event
+	for _, event := range storyboard.List {
+		if event.EventType != types.EventTypeSprite {
+			others = append(others, event)
+		}
 	}
-	defer zipFile.Close()
+	writeEvents(&sb, others)
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	layers := []types.StoryboardLayer{
+		types.LayerBackground,
+		types.LayerFail,
+		types.LayerPass,
+		types.LayerForeground,
+		types.LayerOverlay,
+	}
+	for i, layer := range layers {
+		sb.WriteString(fmt.Sprintf("//Storyboard Layer %d (%s)\n", i, layer))
+		for _, event := range storyboard.List {
+			if event.EventType == types.EventTypeSprite && event.EventParams.Layer == layer {
+				writeSprite(&sb, event)
+			}
+		}
+	}
+	sb.WriteString("//Storyboard Sound Samples\n")
+
+	_, err := writer.Write([]byte(sb.String()))
+	return err
+}
+
+func writeEvents(sb *strings.Builder, events []types.Event) {
+	for _, event := range events {
+		switch event.EventType {
+		case types.EventTypeBackground:
+			sb.WriteString(fmt.Sprintf("0,%d,%s,%d,%d\n",
+				event.StartTime,
+				event.EventParams.FileName,
+				event.EventParams.XOffset,
+				event.EventParams.YOffset,
+			))
+		case types.EventTypeVideo:
+			sb.WriteString(fmt.Sprintf("1,%d,%s,%d,%d\n",
+				event.StartTime,
+				event.EventParams.FileName,
+				event.EventParams.XOffset,
+				event.EventParams.YOffset,
+			))
+		case types.EventTypeBreak:
+			sb.WriteString(fmt.Sprintf("2,%d,%d\n",
+				event.StartTime,
+				event.EventParams.EndTime,
+			))
+		case types.EventTypeSprite:
+			writeSprite(sb, event)
+		}
+	}
+}
+
+func writeSprite(sb *strings.Builder, event types.Event) {
+	sb.WriteString(fmt.Sprintf("Sprite,%s,%s,\"%s\",%d,%d\n",
+		event.EventParams.Layer,
+		event.EventParams.Origin,
+		event.EventParams.FileName,
+		event.EventParams.XOffset,
+		event.EventParams.YOffset,
+	))
+
+	for _, command := range event.EventParams.Commands {
+		params := make([]string, 0, len(command.Params))
+		for _, param := range command.Params {
+			params = append(params, strconv.FormatFloat(param, 'f', -1, 64))
+		}
 
-	for _, file := range files {
-		f, err := os.Open(file)
+		sb.WriteString(fmt.Sprintf(" %s,%d,%d,%d,%s\n",
+			command.Type,
+			command.Easing,
+			command.StartTime,
+			command.EndTime,
+			strings.Join(params, ","),
+		))
+	}
+}
+
+func WriteOszContent(osuMap types.OsuMap, writer io.Writer) error {
+	zipWriter := zip.NewWriter(writer)
+
+	for _, diff := range osuMap.Difficulties {
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   OsuFileName(diff),
+			Method: zip.Deflate,
+		})
 		if err != nil {
 			return err
 		}
-		defer f.Close()
 
-		info, err := f.Stat()
+		err = WriteOsuContent(diff, w)
 		if err != nil {
 			return err
 		}
+	}
 
-		header, err := zip.FileInfoHeader(info)
+	if len(osuMap.Storyboard.List) > 0 {
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   OsbFileName(osuMap),
+			Method: zip.Deflate,
+		})
 		if err != nil {
 			return err
 		}
-		header.Name = filepath.Base(file)
-		header.Method = zip.Deflate
 
-		writer, err := zipWriter.CreateHeader(header)
+		err = WriteOsbContent(osuMap.Storyboard, w)
+		if err != nil {
+			return err
+		}
+	}
+
+	// sort names so the archive is the same across runs
+	names := make([]string, 0, len(osuMap.Files))
+	for name := range osuMap.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   name,
+			Method: zip.Deflate,
+		})
 		if err != nil {
 			return err
 		}
 
-		_, err = io.Copy(writer, f)
+		_, err = w.Write(osuMap.Files[name])
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return zipWriter.Close()
 }
@@ -0,0 +1,242 @@
+// Package preview draws charts as PNG-ready images, similar to osu!mania's editor preview.
+// Time flows upwards in vertical strips that are laid out left to right.
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/skin"
+	"github.com/cxntered/SpareChange/pkg/types"
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	laneWidth   = 32
+	labelWidth  = 72 // room for BPM & SV labels left of the lanes
+	stripGap    = 16
+	noteHeight  = 6
+	stripMargin = 8   // px above & below each strip
+	endPadding  = 500 // ms drawn after the last object
+)
+
+var (
+	backgroundColor = color.NRGBA{R: 25, G: 22, B: 84, A: 255}
+	barLineColor    = color.NRGBA{R: 255, G: 255, B: 255, A: 96}
+	bindZoneColor   = color.NRGBA{R: 255, G: 80, B: 120, A: 64}
+	bpmColor        = color.NRGBA{R: 255, G: 96, B: 96, A: 255}
+	svColor         = color.NRGBA{R: 96, G: 255, B: 128, A: 255}
+	timeColor       = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+)
+
+// Options controls the size of the rendered chart
+type Options struct {
+	Scale       float64 // pixels per millisecond, defaults to 0.25
+	StripHeight int     // pixels, defaults to 1200
+}
+
+func (o Options) scale() float64 {
+	if o.Scale <= 0 {
+		return 0.25
+	}
+	return o.Scale
+}
+
+func (o Options) stripHeight() int {
+	if o.StripHeight <= 0 {
+		return 1200
+	}
+	return o.StripHeight
+}
+
+// RenderOsuFile draws a 4K osu!mania difficulty. Kiai time is drawn as bind zones,
+// and notes that were converted from Sparebeat attack notes are drawn as such.
+func RenderOsuFile(osuFile types.OsuFile, opts Options) image.Image {
+	return render(osuFile, converter.KiaiBindZones(osuFile.TimingPoints.List), opts)
+}
+
+// RenderSparebeatLevel draws one level (easy, normal or hard) of a Sparebeat map
+func RenderSparebeatLevel(sbMap types.SparebeatMap, level string, opts Options) (image.Image, error) {
+	// bind zones come from the conversion result instead of kiai time
+	result, err := converter.ConvertSparebeatToOsuWithOptions(sbMap, converter.Options{BindZones: converter.BindZoneNone})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, diff := range result.Map.Difficulties {
+		if strings.EqualFold(diff.Metadata.Version, level) {
+			return render(diff, result.BindZones[diff.Metadata.Version], opts), nil
+		}
+	}
+	return nil, fmt.Errorf("map has no %q level", level)
+}
+
+func render(osuFile types.OsuFile, zones []converter.BindZone, opts Options) image.Image {
+	scale := opts.scale()
+	stripHeight := opts.stripHeight()
+	stripDuration := float64(stripHeight) / scale
+
+	timingPoints := append([]types.TimingPoint(nil), osuFile.TimingPoints.List...)
+	sort.SliceStable(timingPoints, func(i, j int) bool {
+		return timingPoints[i].Time < timingPoints[j].Time
+	})
+
+	start, end := 0, 0
+	for _, hitObject := range osuFile.HitObjects.List {
+		start = min(start, hitObject.Time)
+		end = max(end, hitObject.Time, hitObject.ObjectParams.EndTime)
+	}
+	for _, timingPoint := range timingPoints {
+		start = min(start, timingPoint.Time)
+		end = max(end, timingPoint.Time)
+	}
+	end += endPadding
+
+	strips := max(int(math.Ceil(float64(end-start)/stripDuration)), 1)
+	stripWidth := labelWidth + laneWidth*4
+	canvas := imaging.New(strips*stripWidth+(strips+1)*stripGap, stripHeight+stripMargin*2, backgroundColor)
+
+	for i := range strips {
+		s := strip{
+			img:   imaging.New(stripWidth, stripHeight, color.Transparent),
+			start: float64(start) + float64(i)*stripDuration,
+			scale: scale,
+		}
+		s.drawLanes()
+		for _, zone := range zones {
+			s.drawBindZone(zone)
+		}
+		s.drawBarLines(timingPoints, end)
+		s.drawLabels(timingPoints)
+		for _, hitObject := range osuFile.HitObjects.List {
+			s.drawHitObject(hitObject)
+		}
+		s.drawTime()
+
+		offset := image.Pt(stripGap+i*(stripWidth+stripGap), stripMargin)
+		draw.Draw(canvas, s.img.Bounds().Add(offset), s.img, image.Point{}, draw.Over)
+	}
+
+	return canvas
+}
+
+// strip is one column of the preview, covering stripHeight / scale milliseconds from start
+type strip struct {
+	img   *image.NRGBA
+	start float64
+	scale float64
+}
+
+func (s strip) y(time float64) int {
+	return s.img.Bounds().Dy() - int(math.Round((time-s.start)*s.scale))
+}
+
+func (s strip) fill(rect image.Rectangle, c color.NRGBA) {
+	draw.Draw(s.img, rect, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+func (s strip) text(x int, y int, c color.NRGBA, str string) {
+	drawer := font.Drawer{
+		Dst:  s.img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(str)
+}
+
+func (s strip) drawLanes() {
+	s.fill(image.Rect(labelWidth, 0, labelWidth+laneWidth*4, s.img.Bounds().Dy()), skin.LaneColor)
+	for lane := 1; lane < 4; lane++ {
+		x := labelWidth + lane*laneWidth
+		s.fill(image.Rect(x, 0, x+1, s.img.Bounds().Dy()), color.NRGBA{R: 255, G: 255, B: 255, A: 24})
+	}
+}
+
+func (s strip) drawBindZone(zone converter.BindZone) {
+	s.fill(image.Rect(labelWidth, s.y(float64(zone.End)), labelWidth+laneWidth*4, s.y(float64(zone.Start))), bindZoneColor)
+}
+
+// drawBarLines draws a line at the start of every measure of every uninherited timing point
+func (s strip) drawBarLines(timingPoints []types.TimingPoint, end int) {
+	var redLines []types.TimingPoint
+	for _, timingPoint := range timingPoints {
+		if timingPoint.Uninherited && timingPoint.BeatLength > 0 {
+			redLines = append(redLines, timingPoint)
+		}
+	}
+
+	stripEnd := s.start + float64(s.img.Bounds().Dy())/s.scale
+	for i, redLine := range redLines {
+		until := math.Min(float64(end), stripEnd)
+		if i+1 < len(redLines) {
+			until = math.Min(until, float64(redLines[i+1].Time))
+		}
+
+		measure := redLine.BeatLength * float64(max(redLine.Meter, 1))
+		if measure*s.scale < 1 {
+			continue // bar lines would be less than a pixel apart
+		}
+		first := float64(redLine.Time)
+		if first < s.start {
+			first += math.Floor((s.start-first)/measure) * measure
+		}
+		for t := first; t < until; t += measure {
+			if t >= s.start {
+				y := s.y(t)
+				s.fill(image.Rect(labelWidth, y, labelWidth+laneWidth*4, y+1), barLineColor)
+			}
+		}
+	}
+}
+
+// drawLabels writes the BPM of every uninherited timing point & the scroll speed of every inherited one
+func (s strip) drawLabels(timingPoints []types.TimingPoint) {
+	for _, timingPoint := range timingPoints {
+		y := s.y(float64(timingPoint.Time))
+		if y < 0 || y > s.img.Bounds().Dy() {
+			continue
+		}
+
+		if timingPoint.Uninherited {
+			s.fill(image.Rect(labelWidth-4, y, labelWidth+laneWidth*4, y+1), bpmColor)
+			s.text(2, y, bpmColor, fmt.Sprintf("%.4g BPM", 60000/timingPoint.BeatLength))
+		} else {
+			s.fill(image.Rect(labelWidth-4, y, labelWidth, y+1), svColor)
+			s.text(2, y+12, svColor, fmt.Sprintf("%.3gx", -100/timingPoint.BeatLength))
+		}
+	}
+}
+
+func (s strip) drawHitObject(hitObject types.HitObject) {
+	lane := int(hitObject.XPosition) * 4 / 512
+	x := labelWidth + lane*laneWidth
+
+	c := skin.NoteColor
+	if hitObject.Source.IsAttackNote() {
+		c = skin.AttackColor
+	}
+
+	y := s.y(float64(hitObject.Time))
+	if hitObject.Type&types.HoldNote != 0 {
+		endY := s.y(float64(hitObject.ObjectParams.EndTime))
+		s.fill(image.Rect(x+6, endY, x+laneWidth-6, y), skin.HoldColor)
+		s.fill(image.Rect(x+2, endY-noteHeight/2, x+laneWidth-2, endY+noteHeight/2), skin.HoldColor)
+	}
+	s.fill(image.Rect(x+2, y-noteHeight/2, x+laneWidth-2, y+noteHeight/2), c)
+}
+
+// drawTime labels the bottom of the strip with its start time
+func (s strip) drawTime() {
+	seconds := s.start / 1000
+	s.text(2, s.img.Bounds().Dy()-2, timeColor, fmt.Sprintf("%d:%04.1f", int(seconds)/60, math.Mod(seconds, 60)))
+}
@@ -0,0 +1,48 @@
+package preview
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/skin"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+func TestRenderAttackNotes(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "converter", "testdata", "attack-notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sbMap types.SparebeatMap
+	if err := json.Unmarshal(data, &sbMap); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Scale: 0.25, StripHeight: 1200}
+	img, err := RenderSparebeatLevel(sbMap, "hard", opts)
+	if err != nil {
+		t.Fatalf("RenderSparebeatLevel error: %v", err)
+	}
+	if got := img.Bounds().Dy(); got != 1200+stripMargin*2 {
+		t.Errorf("image height = %d, want %d", got, 1200+stripMargin*2)
+	}
+
+	result, err := converter.ConvertSparebeatToOsu(sbMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first note is an attack note in the first column
+	x := stripGap + labelWidth + laneWidth/2
+	y := stripMargin + 1200 - int(float64(result.Map.Difficulties[0].HitObjects.List[0].Time)*opts.Scale)
+	if got := img.At(x, y); got != skin.AttackColor {
+		t.Errorf("pixel at first note = %v, want attack note color %v", got, skin.AttackColor)
+	}
+
+	if _, err := RenderSparebeatLevel(sbMap, "easy", opts); err == nil {
+		t.Error("rendering a disabled level returned no error")
+	}
+}
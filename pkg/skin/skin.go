@@ -0,0 +1,206 @@
+// Package skin procedurally generates a 4K osu!mania skin that looks like Sparebeat's playfield.
+package skin
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/utils"
+	"github.com/disintegration/imaging"
+)
+
+// Sparebeat's note colors, shared with anything else that draws charts
+var (
+	NoteColor   = utils.HexToNRGBA("#4ad8ff")
+	HoldColor   = utils.HexToNRGBA("#4ad8ff99")
+	AttackColor = utils.HexToNRGBA("#ff3c64")
+	LaneColor   = utils.HexToNRGBA("#000000a0")
+)
+
+const (
+	Name = "SpareChange"
+
+	// images are drawn at a fixed size & scaled to the column width by osu!
+	imageWidth   = 128
+	noteHeight   = 40
+	keyHeight    = 192
+	cornerRadius = 10
+	glowRadius   = 4
+
+	columnWidth = 72
+	hitPosition = 420
+)
+
+// element file names inside the skin, without the .png extension as skin.ini expects
+const (
+	NoteElement       = "sparechange/note"
+	AttackNoteElement = "sparechange/attack"
+	HoldBodyElement   = "sparechange/hold"
+	KeyElement        = "sparechange/key"
+	KeyDownElement    = "sparechange/keyD"
+)
+
+// Options tweak the generated skin
+type Options struct {
+	// AttackNotes draws every note in the attack-note style. osu!mania can't style single notes,
+	// so this is meant for a skin variant used with maps made only of attack notes.
+	AttackNotes bool
+}
+
+// Files returns every file of the skin, keyed by path inside the .osk
+func Files(opts Options) (map[string][]byte, error) {
+	images := map[string]image.Image{
+		NoteElement:       NoteImage(NoteColor),
+		AttackNoteElement: NoteImage(AttackColor),
+		HoldBodyElement:   holdBodyImage(),
+		KeyElement:        keyImage(false),
+		KeyDownElement:    keyImage(true),
+	}
+
+	files := map[string][]byte{"skin.ini": []byte(skinINI(opts))}
+	for name, img := range images {
+		var buf bytes.Buffer
+		err := imaging.Encode(&buf, img, imaging.PNG)
+		if err != nil {
+			return nil, err
+		}
+		files[name+".png"] = buf.Bytes()
+	}
+	return files, nil
+}
+
+// WriteOsk writes the skin as an .osk archive, which osu! imports when opened
+func WriteOsk(opts Options, writer io.Writer) error {
+	files, err := Files(opts)
+	if err != nil {
+		return err
+	}
+
+	// sort names so the archive is the same across runs
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zipWriter := zip.NewWriter(writer)
+	for _, name := range names {
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   name,
+			Method: zip.Deflate,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(files[name])
+		if err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func skinINI(opts Options) string {
+	note := NoteElement
+	name := Name
+	if opts.AttackNotes {
+		note = AttackNoteElement
+		name += " (attack notes)"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[General]\n")
+	sb.WriteString(fmt.Sprintf("Name: %s\n", name))
+	sb.WriteString("Author: SpareChange\n")
+	sb.WriteString("Version: 2.5\n\n")
+
+	sb.WriteString("[Mania]\n")
+	sb.WriteString("Keys: 4\n")
+	sb.WriteString(fmt.Sprintf("ColumnWidth: %[1]d,%[1]d,%[1]d,%[1]d\n", columnWidth))
+	sb.WriteString("ColumnLineWidth: 0,0,0,0,0\n")
+	sb.WriteString(fmt.Sprintf("HitPosition: %d\n", hitPosition))
+	sb.WriteString("JudgementLine: 1\n")
+	sb.WriteString("KeysUnderNotes: 1\n")
+	sb.WriteString("NoteBodyStyle: 0\n") // stretch the hold body instead of tiling it
+	sb.WriteString(fmt.Sprintf("ColourJudgementLine: %d,%d,%d,255\n", NoteColor.R, NoteColor.G, NoteColor.B))
+	for i := range 4 {
+		sb.WriteString(fmt.Sprintf("Colour%d: %d,%d,%d,%d\n", i+1, LaneColor.R, LaneColor.G, LaneColor.B, LaneColor.A))
+		sb.WriteString(fmt.Sprintf("NoteImage%d: %s\n", i, note))
+		sb.WriteString(fmt.Sprintf("NoteImage%dH: %s\n", i, note))
+		sb.WriteString(fmt.Sprintf("NoteImage%dT: %s\n", i, note))
+		sb.WriteString(fmt.Sprintf("NoteImage%dL: %s\n", i, HoldBodyElement))
+		sb.WriteString(fmt.Sprintf("KeyImage%d: %s\n", i, KeyElement))
+		sb.WriteString(fmt.Sprintf("KeyImage%dD: %s\n", i, KeyDownElement))
+	}
+	return sb.String()
+}
+
+// NoteImage draws a Sparebeat-style note: a white bar with a colored rim & glow
+func NoteImage(c color.NRGBA) image.Image {
+	img := imaging.New(imageWidth, noteHeight, color.Transparent)
+
+	glow := roundedRect(imageWidth-glowRadius*2, noteHeight-glowRadius*2, cornerRadius, c)
+	img = imaging.Overlay(img, glow, image.Pt(glowRadius, glowRadius), 1)
+	img = imaging.Blur(img, glowRadius/2)
+
+	rim := roundedRect(imageWidth-glowRadius*2, noteHeight-glowRadius*2, cornerRadius, c)
+	img = imaging.Overlay(img, rim, image.Pt(glowRadius, glowRadius), 1)
+
+	core := roundedRect(imageWidth-glowRadius*2-8, noteHeight-glowRadius*2-8, cornerRadius-4, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	return imaging.Overlay(img, core, image.Pt(glowRadius+4, glowRadius+4), 1)
+}
+
+// holdBodyImage is a single row stretched along the hold, brighter in the middle
+func holdBodyImage() image.Image {
+	img := imaging.New(imageWidth, 1, color.Transparent)
+	margin := glowRadius + 8
+	for x := margin; x < imageWidth-margin; x++ {
+		// fade from the hold color at the edges to white in the middle
+		t := 1 - math.Abs(float64(x-imageWidth/2))/float64(imageWidth/2-margin)
+		c := utils.InterpolateColor(HoldColor, color.NRGBA{R: 255, G: 255, B: 255, A: HoldColor.A}, t*0.5)
+		img.SetNRGBA(x, 0, c)
+	}
+	return img
+}
+
+// keyImage draws the receptor under each column, lit up in the note color while pressed
+func keyImage(pressed bool) image.Image {
+	img := imaging.New(imageWidth, keyHeight, color.Transparent)
+	top := color.NRGBA{R: 255, G: 255, B: 255, A: 24}
+	bottom := color.NRGBA{R: 255, G: 255, B: 255, A: 64}
+	if pressed {
+		top = color.NRGBA{R: NoteColor.R, G: NoteColor.G, B: NoteColor.B, A: 64}
+		bottom = color.NRGBA{R: NoteColor.R, G: NoteColor.G, B: NoteColor.B, A: 192}
+	}
+
+	for y := range keyHeight {
+		c := utils.InterpolateColor(top, bottom, float64(y)/float64(keyHeight-1))
+		for x := 2; x < imageWidth-2; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func roundedRect(width int, height int, radius int, c color.NRGBA) *image.NRGBA {
+	img := imaging.New(width, height, color.Transparent)
+	for y := range height {
+		for x := range width {
+			// distance from the nearest corner's center, if the pixel is in a corner
+			dx := max(radius-x, x-(width-1-radius), 0)
+			dy := max(radius-y, y-(height-1-radius), 0)
+			if dx*dx+dy*dy <= radius*radius {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
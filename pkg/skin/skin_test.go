@@ -0,0 +1,31 @@
+package skin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSkinElementsExist(t *testing.T) {
+	for _, opts := range []Options{{}, {AttackNotes: true}} {
+		files, err := Files(opts)
+		if err != nil {
+			t.Fatalf("Files(%+v) error: %v", opts, err)
+		}
+
+		ini := string(files["skin.ini"])
+		if !strings.Contains(ini, "[Mania]\nKeys: 4\n") {
+			t.Errorf("skin.ini has no 4K [Mania] section:\n%s", ini)
+		}
+
+		// every image skin.ini points at has to be in the skin
+		for _, line := range strings.Split(ini, "\n") {
+			key, value, _ := strings.Cut(line, ": ")
+			if !strings.HasPrefix(key, "NoteImage") && !strings.HasPrefix(key, "KeyImage") {
+				continue
+			}
+			if _, ok := files[value+".png"]; !ok {
+				t.Errorf("%s refers to missing image %s.png", key, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package stats summarizes converted levels, for reports & map databases.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cxntered/SpareChange/pkg/analysis"
+	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// LevelStats describes one level. Times are in milliseconds.
+type LevelStats struct {
+	Level        string      `json:"level"`
+	Notes        int         `json:"notes"`       // single notes, including attack notes
+	Holds        int         `json:"holds"`       // hold notes
+	AttackNotes  int         `json:"attackNotes"` // attack notes, as far as the source is known
+	Duration     int         `json:"duration"`    // from the first note to the end of the last one
+	PeakNPS      float64     `json:"peakNps"`     // most notes started within any second
+	AverageNPS   float64     `json:"averageNps"`
+	Chords       map[int]int `json:"chords"` // notes started at the same time -> how often that happens
+	MinBPM       float64     `json:"minBpm"`
+	MaxBPM       float64     `json:"maxBpm"`
+	SpeedChanges int         `json:"speedChanges"`
+	BindZoneTime int         `json:"bindZoneTime"`
+
+	Patterns []analysis.Pattern `json:"patterns"` // dominant patterns, most common first
+}
+
+// FromResult computes the stats of every level of a converted Sparebeat map
+func FromResult(result converter.Result) []LevelStats {
+	var list []LevelStats
+	for _, diff := range result.Map.Difficulties {
+		list = append(list, Compute(diff, result.BindZones[diff.Metadata.Version]))
+	}
+	return list
+}
+
+// FromOsuMap computes the stats of every level of an osu! map, reading bind zones back from kiai time
+func FromOsuMap(osuMap types.OsuMap) []LevelStats {
+	var list []LevelStats
+	for _, diff := range osuMap.Difficulties {
+		list = append(list, Compute(diff, converter.KiaiBindZones(diff.TimingPoints.List)))
+	}
+	return list
+}
+
+// Compute computes the stats of a single level
+func Compute(osuFile types.OsuFile, zones []converter.BindZone) LevelStats {
+	stats := LevelStats{
+		Level:    osuFile.Metadata.Version,
+		Chords:   make(map[int]int),
+		Patterns: analysis.Analyze(osuFile).Dominant,
+	}
+
+	var starts []int
+	chords := make(map[int]int) // time -> notes started then
+	end := 0
+	for _, hitObject := range osuFile.HitObjects.List {
+		if hitObject.Type&types.HoldNote != 0 {
+			stats.Holds++
+		} else {
+			stats.Notes++
+			if hitObject.Source.IsAttackNote() {
+				stats.AttackNotes++
+			}
+		}
+		starts = append(starts, hitObject.Time)
+		chords[hitObject.Time]++
+		end = max(end, hitObject.Time, hitObject.ObjectParams.EndTime)
+	}
+	sort.Ints(starts)
+
+	for _, size := range chords {
+		stats.Chords[size]++
+	}
+
+	if len(starts) > 0 {
+		stats.Duration = end - starts[0]
+
+		// slide a one second window over the note starts
+		first := 0
+		for last := range starts {
+			for starts[last]-starts[first] >= 1000 {
+				first++
+			}
+			stats.PeakNPS = math.Max(stats.PeakNPS, float64(last-first+1))
+		}
+		if stats.Duration > 0 {
+			stats.AverageNPS = float64(len(starts)) / (float64(stats.Duration) / 1000)
+		} else {
+			stats.AverageNPS = float64(len(starts))
+		}
+	}
+
+	timingPoints := append([]types.TimingPoint(nil), osuFile.TimingPoints.List...)
+	sort.SliceStable(timingPoints, func(i, j int) bool {
+		if timingPoints[i].Time != timingPoints[j].Time {
+			return timingPoints[i].Time < timingPoints[j].Time
+		}
+		return timingPoints[i].Uninherited && !timingPoints[j].Uninherited
+	})
+
+	// SV that only makes up for a BPM change isn't a speed change, so speeds are compared against the dominant
+	// BPM like the converter does. Sparebeat's speed starts over at every BPM change.
+	baseBPM := converter.DominantBPM(osuFile)
+	bpm, speed := baseBPM, 1.0
+	for _, timingPoint := range timingPoints {
+		if timingPoint.Uninherited {
+			if timingPoint.BeatLength <= 0 {
+				continue
+			}
+			// red lines that only restart the bar lines keep the speed
+			if next := 60000 / timingPoint.BeatLength; math.Abs(next-bpm) > 1e-6 {
+				bpm, speed = next, 1
+			}
+			if stats.MinBPM == 0 || bpm < stats.MinBPM {
+				stats.MinBPM = bpm
+			}
+			stats.MaxBPM = math.Max(stats.MaxBPM, bpm)
+		} else if next := -100 / timingPoint.BeatLength * bpm / baseBPM; math.Abs(next-speed) > 0.005 {
+			stats.SpeedChanges++
+			speed = next
+		}
+	}
+
+	for _, zone := range zones {
+		// unclosed zones only count until the end of the level
+		stats.BindZoneTime += max(min(zone.End, end)-zone.Start, 0)
+	}
+
+	return stats
+}
+
+// WriteTable writes the stats as a table with a column per level
+func WriteTable(list []LevelStats, writer io.Writer) error {
+	rows := []struct {
+		name  string
+		value func(s LevelStats) string
+	}{
+		{"Notes", func(s LevelStats) string { return fmt.Sprint(s.Notes) }},
+		{"Holds", func(s LevelStats) string { return fmt.Sprint(s.Holds) }},
+		{"Attack notes", func(s LevelStats) string { return fmt.Sprint(s.AttackNotes) }},
+		{"Duration", func(s LevelStats) string { return formatDuration(s.Duration) }},
+		{"Peak NPS", func(s LevelStats) string { return fmt.Sprintf("%.0f", s.PeakNPS) }},
+		{"Average NPS", func(s LevelStats) string { return fmt.Sprintf("%.2f", s.AverageNPS) }},
+		{"Chords", func(s LevelStats) string { return formatChords(s.Chords) }},
+		{"BPM", func(s LevelStats) string { return formatBPMRange(s.MinBPM, s.MaxBPM) }},
+		{"Speed changes", func(s LevelStats) string { return fmt.Sprint(s.SpeedChanges) }},
+		{"Bind zone time", func(s LevelStats) string { return formatDuration(s.BindZoneTime) }},
+		{"Patterns", func(s LevelStats) string { return formatPatterns(s.Patterns) }},
+	}
+
+	w := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	header := []string{""}
+	for _, s := range list {
+		header = append(header, s.Level)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := []string{row.name}
+		for _, s := range list {
+			cells = append(cells, row.value(s))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func formatDuration(ms int) string {
+	return fmt.Sprintf("%d:%04.1f", ms/60000, float64(ms%60000)/1000)
+}
+
+// formatChords lists how often each chord size happens, e.g. "1: 120, 2: 30"
+func formatChords(chords map[int]int) string {
+	sizes := make([]int, 0, len(chords))
+	for size := range chords {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+
+	var parts []string
+	for _, size := range sizes {
+		parts = append(parts, fmt.Sprintf("%d: %d", size, chords[size]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatPatterns(patterns []analysis.Pattern) string {
+	if len(patterns) == 0 {
+		return "-"
+	}
+	names := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		names[i] = string(pattern)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatBPMRange(min float64, max float64) string {
+	if min == max {
+		return fmt.Sprintf("%.4g", min)
+	}
+	return fmt.Sprintf("%.4g-%.4g", min, max)
+}
@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+func TestCompute(t *testing.T) {
+	osuFile := types.OsuFile{
+		Metadata: types.MetadataSection{Version: "Hard"},
+		TimingPoints: types.TimingPointsSection{List: []types.TimingPoint{
+			{Time: 0, BeatLength: 500, Uninherited: true},
+			{Time: 0, BeatLength: -100},
+			{Time: 1000, BeatLength: -50},
+			{Time: 1500, BeatLength: -50},
+			{Time: 2000, BeatLength: 250, Uninherited: true},
+		}},
+		HitObjects: types.HitObjectsSection{List: []types.HitObject{
+			{XPosition: 64, Time: 0, Type: types.HitCircle},
+			{XPosition: 192, Time: 0, Type: types.HitCircle, Source: &types.SourcePos{Char: "6"}},
+			{XPosition: 320, Time: 250, Type: types.HitCircle},
+			{XPosition: 448, Time: 500, Type: types.HoldNote, ObjectParams: types.ObjectParams{EndTime: 3000}},
+			{XPosition: 64, Time: 2000, Type: types.HitCircle},
+		}},
+	}
+	zones := []converter.BindZone{{Start: 500, End: 1500, Closed: true}, {Start: 2500, End: 99999}}
+
+	want := LevelStats{
+		Level:        "Hard",
+		Notes:        4,
+		Holds:        1,
+		AttackNotes:  1,
+		Duration:     3000,
+		PeakNPS:      4,
+		AverageNPS:   5.0 / 3,
+		Chords:       map[int]int{1: 3, 2: 1},
+		MinBPM:       120,
+		MaxBPM:       240,
+		SpeedChanges: 1,
+		BindZoneTime: 1500,
+	}
+	got := Compute(osuFile, zones)
+	got.Patterns = nil // covered by the analysis tests
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compute() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSpeedChanges(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    int
+	}{
+		{fixture: "bpm-change", want: 0}, // only SV making up for BPM changes
+		{fixture: "slow-intro", want: 2},
+		{fixture: "speed-change", want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "converter", "testdata", tt.fixture+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sbMap types.SparebeatMap
+			if err := json.Unmarshal(data, &sbMap); err != nil {
+				t.Fatal(err)
+			}
+			result, err := converter.ConvertSparebeatToOsu(sbMap)
+			if err != nil {
+				t.Fatalf("ConvertSparebeatToOsu() error: %v", err)
+			}
+			for _, level := range FromResult(result) {
+				if level.SpeedChanges != tt.want {
+					t.Errorf("%s speed changes = %d, want %d", level.Level, level.SpeedChanges, tt.want)
+				}
+			}
+		})
+	}
+}
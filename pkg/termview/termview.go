@@ -0,0 +1,251 @@
+// Package termview renders charts as text for terminals, one line per row with time flowing downwards.
+package termview
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cxntered/SpareChange/pkg/converter"
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+// Options controls how charts are drawn
+type Options struct {
+	RowsPerBeat int  // defaults to 4, notes between rows snap to the nearest one
+	ASCII       bool // only use ASCII characters, for terminals without Unicode fonts
+}
+
+func (o Options) rowsPerBeat() int {
+	if o.RowsPerBeat <= 0 {
+		return 4
+	}
+	return o.RowsPerBeat
+}
+
+type charset struct {
+	note, attack, holdHead, holdBody, holdTail string
+	empty, measure, border, bindZone           string
+}
+
+var (
+	unicodeChars = charset{
+		note: " ■ ", attack: " ✕ ", holdHead: " ■ ", holdBody: " ┃ ", holdTail: " ┻ ",
+		empty: "   ", measure: "───", border: "│", bindZone: "▐",
+	}
+	asciiChars = charset{
+		note: " o ", attack: " x ", holdHead: " o ", holdBody: " | ", holdTail: " ^ ",
+		empty: "   ", measure: "---", border: "|", bindZone: "#",
+	}
+)
+
+// row is one line of the chart
+type row struct {
+	time     float64
+	measure  int // measure number if the row starts one, else 0
+	beat     bool
+	cells    [4]string
+	bindZone bool
+	notes    []string
+}
+
+// RenderOsuFile draws a 4K osu!mania difficulty, with kiai time drawn as bind zones
+func RenderOsuFile(osuFile types.OsuFile, opts Options) []string {
+	return render(osuFile, converter.KiaiBindZones(osuFile.TimingPoints.List), opts)
+}
+
+// RenderSparebeatLevel draws one level (easy, normal or hard) of a Sparebeat map
+func RenderSparebeatLevel(sbMap types.SparebeatMap, level string, opts Options) ([]string, error) {
+	// bind zones come from the conversion result instead of kiai time
+	result, err := converter.ConvertSparebeatToOsuWithOptions(sbMap, converter.Options{BindZones: converter.BindZoneNone})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, diff := range result.Map.Difficulties {
+		if strings.EqualFold(diff.Metadata.Version, level) {
+			return render(diff, result.BindZones[diff.Metadata.Version], opts), nil
+		}
+	}
+	return nil, fmt.Errorf("map has no %q level", level)
+}
+
+func render(osuFile types.OsuFile, zones []converter.BindZone, opts Options) []string {
+	chars := unicodeChars
+	if opts.ASCII {
+		chars = asciiChars
+	}
+
+	rows := buildRows(osuFile, opts.rowsPerBeat())
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for _, hitObject := range osuFile.HitObjects.List {
+		lane := min(max(int(hitObject.XPosition)*4/512, 0), 3)
+		head := nearestRow(rows, float64(hitObject.Time))
+
+		if hitObject.Type&types.HoldNote != 0 {
+			tail := nearestRow(rows, float64(hitObject.ObjectParams.EndTime))
+			for i := head + 1; i < tail; i++ {
+				rows[i].cells[lane] = chars.holdBody
+			}
+			if tail > head {
+				rows[tail].cells[lane] = chars.holdTail
+			}
+			rows[head].cells[lane] = chars.holdHead
+		} else if hitObject.Source.IsAttackNote() {
+			rows[head].cells[lane] = chars.attack
+		} else {
+			rows[head].cells[lane] = chars.note
+		}
+	}
+
+	for _, timingPoint := range osuFile.TimingPoints.List {
+		i := nearestRow(rows, float64(timingPoint.Time))
+		if timingPoint.Uninherited {
+			rows[i].notes = append(rows[i].notes, fmt.Sprintf("%.4g BPM", 60000/timingPoint.BeatLength))
+		} else {
+			rows[i].notes = append(rows[i].notes, fmt.Sprintf("%.3gx speed", -100/timingPoint.BeatLength))
+		}
+	}
+
+	for _, zone := range zones {
+		for i := range rows {
+			if rows[i].time >= float64(zone.Start) && rows[i].time < float64(zone.End) {
+				rows[i].bindZone = true
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		var sb strings.Builder
+
+		if r.measure > 0 {
+			sb.WriteString(fmt.Sprintf("%4d ", r.measure))
+		} else {
+			sb.WriteString("     ")
+		}
+		if r.beat {
+			sb.WriteString(fmt.Sprintf("%9s ", FormatTime(r.time)))
+		} else {
+			sb.WriteString(strings.Repeat(" ", 10))
+		}
+
+		sb.WriteString(chars.border)
+		for _, cell := range r.cells {
+			if cell == "" {
+				cell = chars.empty
+				if r.measure > 0 {
+					cell = chars.measure
+				}
+			}
+			sb.WriteString(cell)
+		}
+		sb.WriteString(chars.border)
+
+		if r.bindZone {
+			sb.WriteString(chars.bindZone)
+		} else {
+			sb.WriteString(" ")
+		}
+		if len(r.notes) > 0 {
+			sb.WriteString(" " + strings.Join(r.notes, ", "))
+		}
+
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+	return lines
+}
+
+// buildRows lays out rows on the beat grid of every uninherited timing point,
+// from the first note or timing point to the last object or timing point
+func buildRows(osuFile types.OsuFile, rowsPerBeat int) []row {
+	var redLines []types.TimingPoint
+	for _, timingPoint := range osuFile.TimingPoints.List {
+		if timingPoint.Uninherited && timingPoint.BeatLength > 0 {
+			redLines = append(redLines, timingPoint)
+		}
+	}
+	sort.SliceStable(redLines, func(i, j int) bool {
+		return redLines[i].Time < redLines[j].Time
+	})
+	if len(redLines) == 0 {
+		return nil
+	}
+
+	start, end := float64(redLines[0].Time), float64(redLines[0].Time)
+	for _, timingPoint := range osuFile.TimingPoints.List {
+		end = math.Max(end, float64(timingPoint.Time))
+	}
+	for _, hitObject := range osuFile.HitObjects.List {
+		start = math.Min(start, float64(hitObject.Time))
+		end = math.Max(end, float64(max(hitObject.Time, hitObject.ObjectParams.EndTime)))
+	}
+
+	var rows []row
+	measure := 0
+	for i, redLine := range redLines {
+		// rows closer than a millisecond apart would only be noise
+		step := math.Max(redLine.BeatLength/float64(rowsPerBeat), 1)
+		perMeasure := rowsPerBeat * int(max(redLine.Meter, 1))
+
+		from := float64(redLine.Time)
+		k := 0
+		if len(rows) == 0 {
+			// extend the first grid backwards to cover notes before the first timing point
+			k = -int(math.Ceil((from - start) / step))
+		}
+		until := end
+		if i+1 < len(redLines) {
+			until = float64(redLines[i+1].Time) - step/2
+		}
+
+		for ; from+float64(k)*step <= until; k++ {
+			r := row{time: from + float64(k)*step}
+			if k >= 0 && k%perMeasure == 0 {
+				measure++
+				r.measure = measure
+			}
+			r.beat = k%rowsPerBeat == 0
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// MeasureStarts returns the indexes of the lines that start a measure, which are the ones with a measure number
+func MeasureStarts(lines []string) []int {
+	var starts []int
+	for i, line := range lines {
+		if len(line) >= 5 && strings.TrimSpace(line[:5]) != "" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+func nearestRow(rows []row, time float64) int {
+	i := sort.Search(len(rows), func(i int) bool {
+		return rows[i].time >= time
+	})
+	if i == len(rows) {
+		return len(rows) - 1
+	}
+	if i > 0 && time-rows[i-1].time < rows[i].time-time {
+		return i - 1
+	}
+	return i
+}
+
+// FormatTime formats milliseconds as m:ss.mmm
+func FormatTime(ms float64) string {
+	sign := ""
+	if ms < 0 {
+		sign, ms = "-", -ms
+	}
+	total := int(math.Round(ms))
+	return fmt.Sprintf("%s%d:%02d.%03d", sign, total/60000, total/1000%60, total%1000)
+}
@@ -0,0 +1,58 @@
+package termview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cxntered/SpareChange/pkg/types"
+)
+
+func TestRenderOsuFile(t *testing.T) {
+	osuFile := types.OsuFile{
+		TimingPoints: types.TimingPointsSection{List: []types.TimingPoint{
+			{Time: 1000, BeatLength: 500, Meter: 4, Uninherited: true},
+			{Time: 3000, BeatLength: -50, Effects: types.EffectKiaiTime},
+			{Time: 4000, BeatLength: -100},
+		}},
+		HitObjects: types.HitObjectsSection{List: []types.HitObject{
+			{XPosition: 64, Time: 1000, Type: types.HitCircle},
+			{XPosition: 192, Time: 1125, Type: types.HitCircle, Source: &types.SourcePos{Char: "6"}},
+			{XPosition: 448, Time: 1500, Type: types.HoldNote, ObjectParams: types.ObjectParams{EndTime: 2000}},
+		}},
+	}
+
+	lines := RenderOsuFile(osuFile, Options{ASCII: true})
+	want := []string{
+		"   1  0:01.000 | o ---------|  120 BPM",
+		"               |    x       |",
+		"               |            |",
+		"               |            |",
+		"      0:01.500 |          o |",
+		"               |          | |",
+		"               |          | |",
+		"               |          | |",
+		"      0:02.000 |          ^ |",
+	}
+	if len(lines) < len(want) {
+		t.Fatalf("got %d lines, want at least %d", len(lines), len(want))
+	}
+	for i, line := range want {
+		if lines[i] != line {
+			t.Errorf("line %d = %q, want %q", i, lines[i], line)
+		}
+	}
+
+	if starts := MeasureStarts(lines); len(starts) < 2 || starts[0] != 0 || starts[1] != 16 {
+		t.Errorf("MeasureStarts() = %v, want measures every 16 lines from 0", starts)
+	}
+
+	// the kiai section from 3000 to 4000ms is a bind zone
+	for _, line := range lines {
+		if strings.Contains(line, "0:03.000") && !strings.Contains(line, "|# 2x speed") {
+			t.Errorf("line at 3000ms = %q, want a bind zone & speed change", line)
+		}
+		if strings.Contains(line, "0:04.000") && strings.Contains(line, "#") {
+			t.Errorf("line at 4000ms = %q, want it outside the bind zone", line)
+		}
+	}
+}
@@ -6,7 +6,14 @@ type OsuMap struct {
 	Metadata     MetadataSection
 	Difficulty   DifficultySection
 	Events       EventsSection
+	Storyboard   EventsSection // written to an .osb shared by every difficulty
 	Difficulties []OsuFile
+
+	// extra files bundled into the .osz alongside the difficulties (e.g. audio & background)
+	Files map[string][]byte
+
+	// the original Sparebeat map JSON, if the map was converted from one
+	Source []byte
 }
 
 type OsuFile struct {
@@ -124,18 +131,63 @@ const (
 	EventTypeBackground EventType = 0
 	EventTypeVideo      EventType = 1
 	EventTypeBreak      EventType = 2
+	EventTypeSprite     EventType = 4
 )
 
 type EventParams struct {
-	// background & video specific
+	// background, video & sprite specific
 	FileName string
 	XOffset  int16
 	YOffset  int16
 
 	// break specific
 	EndTime int
+
+	// sprite specific
+	Layer    StoryboardLayer
+	Origin   StoryboardOrigin
+	Commands []StoryboardCommand
 }
 
+type StoryboardLayer string
+
+const (
+	LayerBackground StoryboardLayer = "Background"
+	LayerFail       StoryboardLayer = "Fail"
+	LayerPass       StoryboardLayer = "Pass"
+	LayerForeground StoryboardLayer = "Foreground"
+	LayerOverlay    StoryboardLayer = "Overlay"
+)
+
+type StoryboardOrigin string
+
+const (
+	OriginTopLeft      StoryboardOrigin = "TopLeft"
+	OriginCentre       StoryboardOrigin = "Centre"
+	OriginCentreLeft   StoryboardOrigin = "CentreLeft"
+	OriginTopCentre    StoryboardOrigin = "TopCentre"
+	OriginBottomCentre StoryboardOrigin = "BottomCentre"
+)
+
+type StoryboardCommand struct {
+	Type      CommandType
+	Easing    uint8
+	StartTime int
+	EndTime   int
+	Params    []float64
+}
+
+type CommandType string
+
+const (
+	CommandFade        CommandType = "F"
+	CommandMove        CommandType = "M"
+	CommandScale       CommandType = "S"
+	CommandVectorScale CommandType = "V"
+	CommandRotate      CommandType = "R"
+	CommandColour      CommandType = "C"
+)
+
 type TimingPointsSection struct {
 	List []TimingPoint
 }
@@ -149,6 +201,8 @@ type TimingPoint struct {
 	Volume      int
 	Uninherited bool
 	Effects     Effect
+
+	Source *SourcePos // where in the Sparebeat map this came from, if anywhere
 }
 
 type Effect uint8
@@ -183,6 +237,8 @@ type HitObject struct {
 	HitSound     HitSound
 	ObjectParams ObjectParams
 	HitSample    HitSample
+
+	Source *SourcePos // where in the Sparebeat map this came from, if anywhere
 }
 
 type HitSound uint8
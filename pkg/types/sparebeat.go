@@ -30,3 +30,17 @@ type MapOptions struct {
 	BPM     *float64 `json:"bpm,omitempty"`
 	Speed   *float64 `json:"speed,omitempty"`
 }
+
+// points at the character in a Sparebeat map that an osu! object was converted from
+type SourcePos struct {
+	Level   string `json:"level"`
+	Section int    `json:"section"`        // index into the level's map data
+	Row     int    `json:"row"`            // -1 for map options
+	Column  int    `json:"column"`         // character index within the row, -1 for map options
+	Char    string `json:"char,omitempty"` // the character itself, empty for map options
+}
+
+// IsAttackNote reports whether the source is a Sparebeat attack note (5-8), which is safe to call on nil
+func (p *SourcePos) IsAttackNote() bool {
+	return p != nil && len(p.Char) == 1 && p.Char[0] >= '5' && p.Char[0] <= '8'
+}
@@ -6,6 +6,9 @@ import (
 	"strings"
 )
 
+// Sparebeat's background gradient when a map doesn't set bgColor
+var DefaultBgColor = [2]string{"#43c6ac", "#191654"}
+
 func HexToNRGBA(hex string) color.NRGBA {
 	hex = strings.TrimPrefix(hex, "#")
 	var r, g, b, a uint8 = 0, 0, 0, 255
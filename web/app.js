@@ -6,6 +6,12 @@ const mapUrl = document.getElementById('mapUrl');
 const mapUrlFeedback = document.getElementById('mapUrlFeedback');
 const audioFile = document.getElementById('audioFile');
 const mapFile = document.getElementById('mapFile');
+const bindZones = document.getElementById('bindZones');
+const storyboard = document.getElementById('storyboard');
+const preview = document.getElementById('preview');
+const scrollMode = document.getElementById('scrollMode');
+const offset = document.getElementById('offset');
+const trimSilence = document.getElementById('trimSilence');
 const convertButton = document.getElementById('convertButton');
 const buttonText = document.getElementById('buttonText');
 const loading = document.getElementById('loading');
@@ -13,6 +19,8 @@ const errorInfo = document.getElementById('errorInfo');
 const result = document.getElementById('result');
 const resultContent = document.getElementById('resultContent');
 const downloadButton = document.getElementById('downloadButton');
+const warnings = document.getElementById('warnings');
+const warningList = document.getElementById('warningList');
 
 const go = new Go();
 
@@ -80,15 +88,20 @@ form.addEventListener('submit', async (event) => {
         buttonText.textContent = mapFileData ? 'Loading map...' : 'Downloading map...';
         const sbMap = await getSparebeatMap(mapId, mapFileData, useBeta);
 
+        buttonText.textContent = audioFileData ? 'Loading audio...' : 'Downloading audio...';
+        const audioData = await getAudioData(mapId, audioFileData, useBeta);
+
         buttonText.textContent = 'Converting map...';
-        const osuMap = convertSparebeatMap(JSON.stringify(sbMap));
+        const options = { storyboard: storyboard.checked, beta: useBeta, preview: preview.value, scroll: scrollMode.value, offset: Number(offset.value) || 0, trimSilence: trimSilence.checked, audio: audioData };
+        // left out unless picked, so the converter can default to the storyboard overlay with a storyboard
+        if (bindZones.value) {
+            options.bindZones = bindZones.value;
+        }
+        const osuMap = convertSparebeatMap(JSON.stringify(sbMap), options);
         if (!osuMap.success) {
             throw new Error(osuMap.error || 'Unknown conversion error.');
         }
 
-        buttonText.textContent = audioFileData ? 'Loading audio...' : 'Downloading audio...';
-        const audioData = await getAudioData(mapId, audioFileData, useBeta);
-
         buttonText.textContent = 'Creating background...'
         const backgroundData = await createBackgroundImage(sbMap);
 
@@ -107,6 +120,7 @@ form.addEventListener('submit', async (event) => {
         };
 
         resultContent.innerHTML = `Successfully converted <strong>${fileName}</strong>`;
+        showWarnings(osuMap.warnings ?? []);
         result.classList.remove('d-none');
     } catch (err) {
         console.error(err);
@@ -130,11 +144,22 @@ const setLoading = (isLoading) => {
         errorInfo.textContent = '';
         result.classList.add('d-none');
         resultContent.innerHTML = '';
+        warnings.classList.add('d-none');
+        warningList.replaceChildren();
     } else {
         buttonText.textContent = 'Convert Map';
     }
 };
 
+const showWarnings = (list) => {
+    warningList.replaceChildren(...list.map((warning) => {
+        const item = document.createElement('li');
+        item.textContent = warning.text;
+        return item;
+    }));
+    warnings.classList.toggle('d-none', list.length === 0);
+};
+
 const fetchFromSparebeat = async (url, resourceType) => {
     try {
         const res = await fetch(url);
@@ -217,7 +242,14 @@ const createOszFile = async (osuMap, audioData, backgroundData) => {
         content: new TextEncoder().encode(content)
     }));
 
-    files.push({ name: "audio.mp3", content: audioData });
+    Object.entries(osuMap.assets ?? {}).forEach(([fileName, content]) => {
+        files.push({ name: fileName, content });
+    });
+
+    // the converter returns the audio itself, named after its format
+    if (!Object.keys(osuMap.assets ?? {}).some(fileName => fileName.startsWith("audio."))) {
+        files.push({ name: "audio.mp3", content: audioData });
+    }
     files.push({ name: "background.png", content: backgroundData });
 
     const zip = new JSZip();